@@ -0,0 +1,139 @@
+package procman
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// Runner is implemented by types which run until their context is canceled.
+type Runner interface {
+	Run(ctx context.Context) error
+}
+
+// AdapterOptions for tuning processes created by FromRunner, FromFuncs and FromCloser.
+type AdapterOptions struct {
+	// ShutdownTimeout sets the timeout to wait for Start() to finish after Stop() is called. Defaults to 60 seconds.
+	ShutdownTimeout time.Duration
+	// Clock used for the shutdown timeout. Defaults to the manager's clock or the SystemClock.
+	Clock Clock
+}
+
+func (opts *AdapterOptions) merge(new AdapterOptions) {
+	if new.ShutdownTimeout > 0 {
+		opts.ShutdownTimeout = new.ShutdownTimeout
+	}
+	if new.Clock != nil {
+		opts.Clock = new.Clock
+	}
+}
+
+type adapter struct {
+	runner  *periodical
+	start   func(ctx context.Context) error
+	stop    func() error
+	stopErr error
+}
+
+// FromRunner creates a process which calls Run with a context canceled when the process is stopped. The context.Canceled
+// error most runners return once stopped is ignored.
+func FromRunner(runner Runner, opts ...AdapterOptions) Process {
+	return newAdapter(func(ctx context.Context) error {
+		err := runner.Run(ctx)
+		if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	}, nil, opts...)
+}
+
+// FromFuncs creates a process which calls start, expected to block while running, and calls stop when the process is
+// stopped, such as the ListenAndServe and Shutdown methods of a server. Errors returned by start after stop was called
+// are ignored, since start usually fails with a sentinel error such as http.ErrServerClosed; errors returned by stop are
+// returned by Stop.
+func FromFuncs(start, stop func() error, opts ...AdapterOptions) Process {
+	return newAdapter(func(ctx context.Context) error {
+		err := start()
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}, stop, opts...)
+}
+
+// FromCloser creates a process for types which start in the background, calling start, expected to return right away,
+// and then running until the process is stopped, at which point closer is closed. Start returns the error of start, in
+// which case closer is not closed; errors returned by Close are returned by Stop.
+func FromCloser(start func() error, closer io.Closer, opts ...AdapterOptions) Process {
+	return newAdapter(func(ctx context.Context) error {
+		if err := start(); err != nil {
+			return err
+		}
+		<-ctx.Done()
+		return nil
+	}, closer.Close, opts...)
+}
+
+func newAdapter(start func(ctx context.Context) error, stop func() error, opts ...AdapterOptions) *adapter {
+	var options AdapterOptions
+	for _, opt := range opts {
+		options.merge(opt)
+	}
+	a := &adapter{
+		start: start,
+		stop:  stop,
+	}
+	a.runner = newPeriodical(0, false, func(ctx context.Context) (time.Duration, error) {
+		return 0, a.run(ctx)
+	}, PeriodicalOptions{
+		Once:            true,
+		ShutdownTimeout: options.ShutdownTimeout,
+		Clock:           options.Clock,
+	})
+	return a
+}
+
+func (a *adapter) Start() error {
+	return a.runner.Start()
+}
+
+// Stop cancels the context given to the runner, or calls the stop function, and waits for Start to return.
+func (a *adapter) Stop() error {
+	if err := a.runner.Stop(); err != nil {
+		return err
+	}
+	return a.stopErr
+}
+
+func (a *adapter) manage(env environment) {
+	a.runner.manage(env)
+}
+
+// run calls the start function and, if the adapter has one, the stop function once ctx is canceled, waiting for both to
+// return.
+func (a *adapter) run(ctx context.Context) error {
+	if a.stop == nil {
+		return a.call("starting", func() error { return a.start(ctx) })
+	}
+
+	var returned, stopped = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			a.stopErr = a.call("stopping", a.stop)
+		case <-returned:
+		}
+	}()
+	err := a.call("starting", func() error { return a.start(ctx) })
+	close(returned)
+	<-stopped
+	return err
+}
+
+// call runs fn converting panics to errors, like the manager does for every process, so adapters can also be used on
+// their own.
+func (a *adapter) call(stage string, fn func() error) error {
+	return safely("process panic when "+stage, fn)
+}
@@ -0,0 +1,170 @@
+package procman
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type SampleRunner struct {
+	err error
+}
+
+func (r *SampleRunner) Run(ctx context.Context) error {
+	if r.err != nil {
+		return r.err
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type SampleCloser struct {
+	err    error
+	closed int32
+}
+
+func (c *SampleCloser) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return c.err
+}
+
+func (c *SampleCloser) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+func TestAdapters(t *testing.T) {
+	// run starts p and returns a channel with the error it returns.
+	var run = func(p Process) chan error {
+		var errs = make(chan error, 1)
+		go func() {
+			errs <- p.Start()
+		}()
+		flapWings()
+		return errs
+	}
+
+	t.Run("runner", func(t *testing.T) {
+		var p = FromRunner(&SampleRunner{})
+		var errs = run(p)
+		assert.Nil(t, p.Stop())
+		assert.Nil(t, <-errs)
+		assert.Error(t, p.Start())
+	})
+	t.Run("runner-error", func(t *testing.T) {
+		var p = FromRunner(&SampleRunner{err: errDefault})
+		assert.ErrorIs(t, p.Start(), errDefault)
+	})
+	t.Run("funcs-http-server", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		var srv = &http.Server{Addr: ln.Addr().String(), Handler: http.NotFoundHandler()}
+		ln.Close()
+		var p = FromFuncs(srv.ListenAndServe, func() error {
+			return srv.Shutdown(context.Background())
+		})
+		var errs = run(p)
+		changeGear()
+		res, err := http.Get("http://" + srv.Addr)
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+		assert.Nil(t, p.Stop())
+		assert.Nil(t, <-errs)
+	})
+	t.Run("funcs-stop-error", func(t *testing.T) {
+		var quit = make(chan struct{})
+		var p = FromFuncs(func() error {
+			<-quit
+			return nil
+		}, func() error {
+			close(quit)
+			return errDefault
+		})
+		var errs = run(p)
+		assert.ErrorIs(t, p.Stop(), errDefault)
+		assert.Nil(t, <-errs)
+	})
+	t.Run("funcs-start-error", func(t *testing.T) {
+		var stopped bool
+		var p = FromFuncs(func() error {
+			return errDefault
+		}, func() error {
+			stopped = true
+			return nil
+		})
+		assert.ErrorIs(t, p.Start(), errDefault)
+		assert.False(t, stopped)
+	})
+	t.Run("closer", func(t *testing.T) {
+		var closer = &SampleCloser{}
+		var p = FromCloser(func() error {
+			// starts in the background and returns right away
+			return nil
+		}, closer)
+		var errs = run(p)
+		changeGear()
+		select {
+		case err := <-errs:
+			t.Fatalf("process returned before being stopped: %v", err)
+		default:
+		}
+		assert.False(t, closer.isClosed())
+		assert.Nil(t, p.Stop())
+		assert.Nil(t, <-errs)
+		assert.True(t, closer.isClosed())
+	})
+	t.Run("closer-errors", func(t *testing.T) {
+		var closer = &SampleCloser{err: errDefault}
+		var p = FromCloser(func() error { return nil }, closer)
+		var errs = run(p)
+		assert.ErrorIs(t, p.Stop(), errDefault)
+		assert.Nil(t, <-errs)
+
+		closer = &SampleCloser{}
+		p = FromCloser(func() error { return errDefault }, closer)
+		assert.ErrorIs(t, p.Start(), errDefault)
+		assert.False(t, closer.isClosed())
+	})
+	t.Run("panics", func(t *testing.T) {
+		var p = FromFuncs(func() error {
+			panic("oops")
+		}, func() error {
+			return nil
+		})
+		assert.ErrorContains(t, p.Start(), "process panic when starting; oops")
+
+		var quit = make(chan struct{})
+		p = FromFuncs(func() error {
+			<-quit
+			return nil
+		}, func() error {
+			close(quit)
+			panic("oops")
+		})
+		var errs = run(p)
+		assert.ErrorContains(t, p.Stop(), "process panic when stopping; oops")
+		assert.Nil(t, <-errs)
+	})
+	t.Run("stop-before-start", func(t *testing.T) {
+		var p = FromRunner(&SampleRunner{})
+		assert.Nil(t, p.Stop())
+		assert.Error(t, p.Start())
+	})
+	t.Run("manager", func(t *testing.T) {
+		pman := NewManager()
+		pman.AddProcess("runner", FromRunner(&SampleRunner{}))
+		// the manager stops once a process fails
+		pman.AddProcess("failing", FromRunner(&SampleRunner{err: errDefault}))
+		terminated := make(chan struct{})
+		go func() {
+			pman.Start()
+			close(terminated)
+		}()
+		assert.NoError(t, waitFor("manager", terminated, 5*time.Second))
+	})
+}
@@ -0,0 +1,190 @@
+package procman
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BatchWorkerOptions for tuning batch workers.
+type BatchWorkerOptions struct {
+	// MaxSize of a batch, which is flushed as soon as it is reached. Defaults to 100.
+	MaxSize int
+	// MaxLatency is the max time an item waits in a batch before it is flushed. Defaults to 1 second.
+	MaxLatency time.Duration
+	// ShutdownTimeout sets the timeout to wait for Start() to finish, including the final flush, after Stop() is called.
+	// Defaults to 60 seconds.
+	ShutdownTimeout time.Duration
+	// Clock used for the batch latency and shutdown timeout. Defaults to the manager's clock or the SystemClock.
+	Clock Clock
+}
+
+func (opts *BatchWorkerOptions) merge(new BatchWorkerOptions) {
+	if new.MaxSize > 0 {
+		opts.MaxSize = new.MaxSize
+	}
+	if new.MaxLatency > 0 {
+		opts.MaxLatency = new.MaxLatency
+	}
+	if new.ShutdownTimeout > 0 {
+		opts.ShutdownTimeout = new.ShutdownTimeout
+	}
+	if new.Clock != nil {
+		opts.Clock = new.Clock
+	}
+}
+
+func (opts *BatchWorkerOptions) sanitize() {
+	if opts.MaxSize < 1 {
+		opts.MaxSize = 100
+	}
+	if opts.MaxLatency <= 0 {
+		opts.MaxLatency = time.Second
+	}
+}
+
+type batchStats struct {
+	batches      uint64
+	items        uint64
+	lastSize     int
+	lastDuration time.Duration
+	maxDuration  time.Duration
+}
+
+type batchWorker[T any] struct {
+	runner *periodical
+	in     <-chan T
+	flush  func(ctx context.Context, batch []T) error
+	opts   BatchWorkerOptions
+	stats  batchStats
+	mux    sync.Mutex
+}
+
+// NewBatchWorker creates a worker which collects the items received from a channel into batches, calling flush whenever a
+// batch reaches MaxSize items or its oldest item has waited for MaxLatency. When the channel is closed or the worker is
+// stopped, the pending items, including those buffered in the channel, are flushed one last time with a context which is
+// only canceled once the ShutdownTimeout is exceeded. The worker stops with the first error returned by flush.
+func NewBatchWorker[T any](in <-chan T, flush func(ctx context.Context, batch []T) error, opts ...BatchWorkerOptions) Process {
+	b := &batchWorker[T]{
+		in:    in,
+		flush: flush,
+	}
+	for _, opt := range opts {
+		b.opts.merge(opt)
+	}
+	b.opts.sanitize()
+	b.runner = newPeriodical(0, false, func(ctx context.Context) (time.Duration, error) {
+		return 0, b.run(ctx)
+	}, PeriodicalOptions{
+		Once:            true,
+		ShutdownTimeout: b.opts.ShutdownTimeout,
+		Clock:           b.opts.Clock,
+	})
+	return b
+}
+
+func (b *batchWorker[T]) Start() error {
+	return b.runner.Start()
+}
+
+func (b *batchWorker[T]) Stop() error {
+	return b.runner.Stop()
+}
+
+func (b *batchWorker[T]) manage(env environment) {
+	b.runner.manage(env)
+}
+
+// Metrics of the batch worker, including the size of the last batch and how long flushes take.
+func (b *batchWorker[T]) Metrics() map[string]float64 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return map[string]float64{
+		"batches":            float64(b.stats.batches),
+		"items":              float64(b.stats.items),
+		"last_batch_size":    float64(b.stats.lastSize),
+		"last_flush_seconds": b.stats.lastDuration.Seconds(),
+		"max_flush_seconds":  b.stats.maxDuration.Seconds(),
+	}
+}
+
+func (b *batchWorker[T]) run(ctx context.Context) error {
+	var clock = b.runner.opts.Clock
+	var batch = make([]T, 0, b.opts.MaxSize)
+	var expired <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return b.shutdown(ctx, batch)
+		case <-expired:
+			if err := b.call(ctx, batch); err != nil {
+				return err
+			}
+			batch, expired = make([]T, 0, b.opts.MaxSize), nil
+		case item, ok := <-b.in:
+			if !ok {
+				return b.shutdown(ctx, batch)
+			}
+			if len(batch) == 0 {
+				expired = clock.After(b.opts.MaxLatency)
+			}
+			if batch = append(batch, item); len(batch) < b.opts.MaxSize {
+				continue
+			}
+			if err := b.call(ctx, batch); err != nil {
+				return err
+			}
+			batch, expired = make([]T, 0, b.opts.MaxSize), nil
+		}
+	}
+}
+
+// shutdown flushes the pending batch along with the items buffered in the channel, using a context which outlives the
+// worker's own until the shutdown timeout.
+func (b *batchWorker[T]) shutdown(ctx context.Context, batch []T) error {
+	var final, cancel = context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	go func() {
+		select {
+		case <-final.Done():
+		case <-b.runner.opts.Clock.After(b.runner.opts.ShutdownTimeout):
+			cancel()
+		}
+	}()
+
+	for n := len(b.in); n > 0; n-- {
+		item, ok := <-b.in
+		if !ok {
+			break
+		}
+		if batch = append(batch, item); len(batch) < b.opts.MaxSize {
+			continue
+		}
+		if err := b.call(final, batch); err != nil {
+			return err
+		}
+		batch = make([]T, 0, b.opts.MaxSize)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	b.runner.opts.Dbgf("flushing final batch")
+	return b.call(final, batch)
+}
+
+// call flushes a batch, recording its stats.
+func (b *batchWorker[T]) call(ctx context.Context, batch []T) error {
+	var clock = b.runner.opts.Clock
+	var started = clock.Now()
+	defer func() {
+		var elapsed = clock.Now().Sub(started)
+		b.mux.Lock()
+		defer b.mux.Unlock()
+		b.stats.batches++
+		b.stats.items += uint64(len(batch))
+		b.stats.lastSize = len(batch)
+		b.stats.lastDuration = elapsed
+		b.stats.maxDuration = max(b.stats.maxDuration, elapsed)
+	}()
+	return safely("batch worker panic", func() error { return b.flush(ctx, batch) })
+}
@@ -0,0 +1,80 @@
+package procman
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchWorker(t *testing.T) {
+	t.Run("max-size", func(t *testing.T) {
+		var ch = make(chan int, 250)
+		for i := 0; i < 250; i++ {
+			ch <- i
+		}
+		close(ch)
+		var sizes []int
+		var b = NewBatchWorker(ch, func(ctx context.Context, batch []int) error {
+			sizes = append(sizes, len(batch))
+			return nil
+		})
+		assert.Nil(t, b.Start())
+		assert.Equal(t, []int{100, 100, 50}, sizes)
+		var metrics = b.(MetricsReporter).Metrics()
+		assert.Equal(t, float64(3), metrics["batches"])
+		assert.Equal(t, float64(250), metrics["items"])
+		assert.Equal(t, float64(50), metrics["last_batch_size"])
+	})
+	t.Run("max-latency", func(t *testing.T) {
+		var clock = NewFakeClock(time.Now())
+		var ch = make(chan int)
+		var batches = make(chan []int)
+		var b = NewBatchWorker(ch, func(ctx context.Context, batch []int) error {
+			batches <- batch
+			return nil
+		}, BatchWorkerOptions{MaxLatency: time.Second, Clock: clock})
+		go b.Start()
+		ch <- 1
+		ch <- 2
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+		assert.Equal(t, []int{1, 2}, <-batches)
+		ch <- 3
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+		assert.Equal(t, []int{3}, <-batches)
+		assert.Nil(t, b.Stop())
+	})
+	t.Run("flush-on-stop", func(t *testing.T) {
+		var ch = make(chan int, 10)
+		var batches = make(chan []int, 1)
+		var b = NewBatchWorker(ch, func(ctx context.Context, batch []int) error {
+			assert.Nil(t, ctx.Err())
+			batches <- batch
+			return nil
+		}, BatchWorkerOptions{MaxLatency: time.Hour})
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, b.Start())
+			close(steps[0])
+		}()
+		ch <- 1
+		flapWings()
+		ch <- 2
+		ch <- 3
+		assert.Nil(t, b.Stop())
+		assert.Nil(t, waitForSteps(steps, time.Second))
+		assert.ElementsMatch(t, []int{1, 2, 3}, <-batches)
+	})
+	t.Run("error", func(t *testing.T) {
+		var ch = make(chan int, 1)
+		ch <- 1
+		close(ch)
+		var b = NewBatchWorker(ch, func(ctx context.Context, batch []int) error {
+			return errDefault
+		})
+		assert.Equal(t, errDefault, b.Start())
+	})
+}
@@ -0,0 +1,200 @@
+package procman
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time used by periodical jobs and the manager. It can be replaced, for instance by a FakeClock
+// in tests, through PeriodicalOptions, WorkerOptions or the manager Parameters.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTicker returns a Ticker which ticks every d.
+	NewTicker(d time.Duration) Ticker
+	// After returns a channel which receives the current time once d elapses.
+	After(d time.Duration) <-chan time.Time
+}
+
+// Ticker delivers ticks at intervals, dropping ticks for slow receivers, just like a time.Ticker.
+type Ticker interface {
+	// C returns the channel on which ticks are delivered.
+	C() <-chan time.Time
+	// Reset stops the ticker and resets its period to d.
+	Reset(d time.Duration)
+	// Stop turns off the ticker.
+	Stop()
+}
+
+// SystemClock returns the Clock backed by the time package, which is the default.
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// FakeClock is a Clock which only moves forward when told to, allowing tests to drive periodical jobs and timeouts
+// deterministically.
+type FakeClock struct {
+	now     time.Time
+	timers  []*fakeTimer
+	changed chan struct{}
+	mux     sync.Mutex
+}
+
+type fakeTimer struct {
+	at     time.Time
+	period time.Duration
+	ch     chan time.Time
+}
+
+// NewFakeClock creates a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now, changed: make(chan struct{})}
+}
+
+// Now returns the current time of the fake clock.
+func (c *FakeClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.now
+}
+
+// After returns a channel which receives the fake clock time once it is advanced by d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	var timer = &fakeTimer{ch: make(chan time.Time, 1)}
+	c.schedule(timer, d)
+	return timer.ch
+}
+
+// NewTicker returns a Ticker which ticks each time the fake clock is advanced past its period.
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock.NewTicker")
+	}
+	var timer = &fakeTimer{period: d, ch: make(chan time.Time, 1)}
+	c.schedule(timer, d)
+	return &fakeTicker{clock: c, timer: timer}
+}
+
+// Advance moves the fake clock forward by d, firing every timer and ticker which expires in the meantime in order.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	var end = c.now.Add(d)
+	for len(c.timers) > 0 && !c.timers[0].at.After(end) {
+		var timer = c.timers[0]
+		c.timers = c.timers[1:]
+		c.now = timer.at
+		select {
+		case timer.ch <- timer.at:
+		default:
+		}
+		if timer.period > 0 {
+			timer.at = timer.at.Add(timer.period)
+			c.insert(timer)
+		}
+	}
+	c.now = end
+}
+
+// Timers returns the number of timers and tickers waiting for the fake clock to advance. Timers created by a call to
+// After are counted until they fire, even if nobody is waiting on them anymore.
+func (c *FakeClock) Timers() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return len(c.timers)
+}
+
+// BlockUntil blocks until there are at least n timers or tickers waiting for the fake clock to advance, which is useful
+// to make sure the code under test is waiting on the clock before calling Advance.
+func (c *FakeClock) BlockUntil(n int) {
+	for {
+		c.mux.Lock()
+		var count, changed = len(c.timers), c.changed
+		c.mux.Unlock()
+		if count >= n {
+			return
+		}
+		<-changed
+	}
+}
+
+func (c *FakeClock) schedule(timer *fakeTimer, d time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	timer.at = c.now.Add(d)
+	if d <= 0 {
+		timer.ch <- c.now
+		return
+	}
+	c.insert(timer)
+}
+
+// insert adds a timer keeping them sorted by expiration; must be called with the lock held.
+func (c *FakeClock) insert(timer *fakeTimer) {
+	var i = sort.Search(len(c.timers), func(i int) bool { return c.timers[i].at.After(timer.at) })
+	c.timers = append(c.timers, nil)
+	copy(c.timers[i+1:], c.timers[i:])
+	c.timers[i] = timer
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// remove a timer; must be called with the lock held.
+func (c *FakeClock) remove(timer *fakeTimer) {
+	for i, t := range c.timers {
+		if t == timer {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+type fakeTicker struct {
+	clock *FakeClock
+	timer *fakeTimer
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.timer.ch
+}
+
+func (t *fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock ticker Reset")
+	}
+	t.clock.mux.Lock()
+	defer t.clock.mux.Unlock()
+	t.clock.remove(t.timer)
+	t.timer.period = d
+	t.timer.at = t.clock.now.Add(d)
+	t.clock.insert(t.timer)
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.mux.Lock()
+	defer t.clock.mux.Unlock()
+	t.clock.remove(t.timer)
+}
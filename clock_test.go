@@ -0,0 +1,49 @@
+package procman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock(t *testing.T) {
+	var epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("after", func(t *testing.T) {
+		var clock = NewFakeClock(epoch)
+		var first, second = clock.After(time.Second), clock.After(2 * time.Second)
+		assert.Equal(t, 2, clock.Timers())
+		clock.Advance(time.Second)
+		assert.Equal(t, epoch.Add(time.Second), <-first)
+		assert.Len(t, second, 0)
+		clock.Advance(time.Hour)
+		assert.Equal(t, epoch.Add(2*time.Second), <-second)
+		assert.Equal(t, epoch.Add(time.Hour+time.Second), clock.Now())
+		assert.Len(t, clock.After(0), 1)
+	})
+	t.Run("ticker", func(t *testing.T) {
+		var clock = NewFakeClock(epoch)
+		var ticker = clock.NewTicker(time.Second)
+		clock.Advance(time.Second)
+		assert.Equal(t, epoch.Add(time.Second), <-ticker.C())
+		clock.Advance(3 * time.Second)
+		assert.Equal(t, epoch.Add(2*time.Second), <-ticker.C())
+		assert.Len(t, ticker.C(), 0)
+		ticker.Reset(time.Minute)
+		clock.Advance(time.Second)
+		assert.Len(t, ticker.C(), 0)
+		ticker.Stop()
+		assert.Equal(t, 0, clock.Timers())
+	})
+	t.Run("block-until", func(t *testing.T) {
+		var clock = NewFakeClock(epoch)
+		var fired = make(chan time.Time)
+		go func() {
+			fired <- <-clock.After(time.Minute)
+		}()
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		assert.Equal(t, epoch.Add(time.Minute), <-fired)
+	})
+}
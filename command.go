@@ -0,0 +1,201 @@
+package procman
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gitlab.com/vredens/go-logger/v2"
+)
+
+// CommandOptions for tuning command processes.
+type CommandOptions struct {
+	// Signal sent to the command, and every process in its process group, when stopping. Defaults to SIGTERM.
+	// Not supported on Windows, where the command is always killed.
+	Signal os.Signal
+	// GracePeriod is the max time the command has to exit after being signaled before it is killed. Defaults to 10
+	// seconds. Stop fails if the command is still running twice the GracePeriod after being stopped.
+	GracePeriod time.Duration
+	// Logger to which the lines written by the command to its stdout and stderr are logged, at info and warning level
+	// respectively. Defaults to the manager's logger, if the command is added to one, or slog.Default().
+	Logger *slog.Logger
+	// Clock used for the grace period. Defaults to the manager's clock or the SystemClock.
+	Clock Clock
+}
+
+func (opts *CommandOptions) merge(new CommandOptions) {
+	if new.Signal != nil {
+		opts.Signal = new.Signal
+	}
+	if new.GracePeriod > 0 {
+		opts.GracePeriod = new.GracePeriod
+	}
+	if new.Logger != nil {
+		opts.Logger = new.Logger
+	}
+	if new.Clock != nil {
+		opts.Clock = new.Clock
+	}
+}
+
+type command struct {
+	runner *periodical
+	cmd    *exec.Cmd
+	opts   CommandOptions
+	name   string
+	log    logger.SLogger
+	ownLog bool
+}
+
+// NewCommand creates a process which runs cmd as a child process, until it exits or the process is stopped. Unless cmd
+// has its own Stdout or Stderr, the lines it writes to them are logged. Stopping the process sends the configured signal
+// to the command's process group and kills it if it is still running after the GracePeriod.
+//
+// Start returns an error describing the exit code or the signal which terminated the command, unless it exited
+// successfully or was terminated by the signal sent when stopping it.
+func NewCommand(cmd *exec.Cmd, opts ...CommandOptions) Process {
+	c := &command{
+		cmd:  cmd,
+		name: filepath.Base(cmd.Path),
+	}
+	for _, opt := range opts {
+		c.opts.merge(opt)
+	}
+	if c.opts.Signal == nil {
+		c.opts.Signal = defaultStopSignal
+	}
+	if c.opts.GracePeriod <= 0 {
+		c.opts.GracePeriod = 10 * time.Second
+	}
+	c.ownLog = c.opts.Logger != nil
+	if c.opts.Logger == nil {
+		c.opts.Logger = slog.Default()
+	}
+	c.log = logger.NewSLogWrapper(c.opts.Logger).WithTags("pman", "process")
+	c.runner = newPeriodical(0, false, func(ctx context.Context) (time.Duration, error) {
+		return 0, c.run(ctx)
+	}, PeriodicalOptions{
+		Once:            true,
+		ShutdownTimeout: 2 * c.opts.GracePeriod,
+		Clock:           c.opts.Clock,
+	})
+	return c
+}
+
+func (c *command) Start() error {
+	return c.runner.Start()
+}
+
+func (c *command) Stop() error {
+	return c.runner.Stop()
+}
+
+func (c *command) manage(env environment) {
+	c.runner.manage(env)
+	if env.name != "" {
+		c.name = env.name
+	}
+	if !c.ownLog {
+		c.log = env.log
+	}
+}
+
+// run starts the command and waits for it to exit, signaling it to stop once ctx is canceled.
+func (c *command) run(ctx context.Context) error {
+	prepareCommand(c.cmd)
+
+	var pipes sync.WaitGroup
+	if c.cmd.Stdout == nil {
+		stdout, err := c.cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		pipes.Add(1)
+		go c.pipe(&pipes, stdout, c.log.Infof)
+	}
+	if c.cmd.Stderr == nil {
+		stderr, err := c.cmd.StderrPipe()
+		if err != nil {
+			return err
+		}
+		pipes.Add(1)
+		go c.pipe(&pipes, stderr, c.log.Warnf)
+	}
+	if err := c.cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start command %s; %w", c.cmd.Path, err)
+	}
+
+	var exited = make(chan error, 1)
+	go func() {
+		// all reads from the pipes must be done before waiting
+		pipes.Wait()
+		exited <- c.cmd.Wait()
+	}()
+
+	select {
+	case err := <-exited:
+		return c.exitError(err, false)
+	case <-ctx.Done():
+	}
+
+	c.runner.opts.Dbgf("signaling command %s to stop", c.cmd.Path)
+	if err := signalCommand(c.cmd, c.opts.Signal); err != nil {
+		c.runner.opts.Dbgf("failed to signal command: %v", err)
+	}
+	select {
+	case err := <-exited:
+		return c.exitError(err, true)
+	case <-c.runner.opts.Clock.After(c.opts.GracePeriod):
+	}
+	if err := killCommand(c.cmd); err != nil {
+		c.runner.opts.Dbgf("failed to kill command: %v", err)
+	}
+	<-exited
+	return fmt.Errorf("command %s killed after grace period of %s", c.cmd.Path, c.opts.GracePeriod)
+}
+
+// maxLogLine is the longest chunk of output logged at once; longer lines are logged in several chunks.
+const maxLogLine = 64 * 1024
+
+// pipe logs every line read from r until it is closed, so the command never blocks writing its output.
+func (c *command) pipe(wg *sync.WaitGroup, r io.Reader, logf func(sfmt string, args ...any)) {
+	defer wg.Done()
+	var reader = bufio.NewReaderSize(r, maxLogLine)
+	for {
+		line, _, err := reader.ReadLine()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				// keep draining so the command does not block
+				io.Copy(io.Discard, r)
+			}
+			return
+		}
+		logf("[process:%s]: %s", c.name, line)
+	}
+}
+
+// exitError converts the result of waiting for the command into the error returned by the process.
+func (c *command) exitError(err error, stopping bool) error {
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) {
+		return err
+	}
+	if stopping && stopKills {
+		return nil
+	}
+	if sig, ok := exitSignal(exit); ok {
+		if stopping && sig == c.opts.Signal {
+			return nil
+		}
+		return fmt.Errorf("command %s terminated by signal %s", c.cmd.Path, sig)
+	}
+	return fmt.Errorf("command %s exited with code %d", c.cmd.Path, exit.ExitCode())
+}
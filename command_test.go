@@ -0,0 +1,102 @@
+//go:build !windows
+// +build !windows
+
+package procman
+
+import (
+	"log/slog"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommand(t *testing.T) {
+	t.Run("output", func(t *testing.T) {
+		var out syncBuffer
+		var log = slog.New(slog.NewTextHandler(&out, nil))
+		var p = NewCommand(exec.Command("sh", "-c", "echo hello; echo oops >&2"), CommandOptions{Logger: log})
+		assert.Nil(t, p.Start())
+		assert.Contains(t, out.String(), `level=INFO msg="[process:sh]: hello"`)
+		assert.Contains(t, out.String(), `level=WARN msg="[process:sh]: oops"`)
+	})
+	t.Run("long-line", func(t *testing.T) {
+		var out syncBuffer
+		var log = slog.New(slog.NewTextHandler(&out, nil))
+		var p = NewCommand(exec.Command("sh", "-c", "head -c 200000 /dev/zero | tr '\\0' a; echo; echo done"), CommandOptions{Logger: log})
+		var errs = make(chan error, 1)
+		go func() {
+			errs <- p.Start()
+		}()
+		select {
+		case err := <-errs:
+			assert.Nil(t, err)
+		case <-time.After(5 * time.Second):
+			p.Stop()
+			t.Fatal("command blocked writing a long line")
+		}
+		// logged in chunks of up to 64KB
+		assert.Equal(t, 4, strings.Count(out.String(), "[process:sh]: aaaa"))
+		assert.Contains(t, out.String(), `msg="[process:sh]: done"`)
+	})
+	t.Run("exit-code", func(t *testing.T) {
+		var p = NewCommand(exec.Command("sh", "-c", "exit 3"))
+		assert.ErrorContains(t, p.Start(), "exited with code 3")
+	})
+	t.Run("missing", func(t *testing.T) {
+		var p = NewCommand(exec.Command("/nonexistent/command"))
+		assert.ErrorContains(t, p.Start(), "failed to start command")
+	})
+	t.Run("stop", func(t *testing.T) {
+		var p = NewCommand(exec.Command("sleep", "10"))
+		var errs = make(chan error, 1)
+		go func() {
+			errs <- p.Start()
+		}()
+		changeGear()
+		assert.Nil(t, p.Stop())
+		assert.Nil(t, <-errs)
+	})
+	t.Run("custom-signal", func(t *testing.T) {
+		var p = NewCommand(exec.Command("sh", "-c", "trap 'exit 0' USR1; while true; do sleep 0.01; done"), CommandOptions{Signal: syscall.SIGUSR1})
+		var errs = make(chan error, 1)
+		go func() {
+			errs <- p.Start()
+		}()
+		changeGear()
+		assert.Nil(t, p.Stop())
+		assert.Nil(t, <-errs)
+	})
+	t.Run("killed-after-grace-period", func(t *testing.T) {
+		var p = NewCommand(exec.Command("sh", "-c", "trap '' TERM; while true; do sleep 0.01; done"), CommandOptions{GracePeriod: 50 * time.Millisecond})
+		var errs = make(chan error, 1)
+		go func() {
+			errs <- p.Start()
+		}()
+		changeGear()
+		assert.Nil(t, p.Stop())
+		assert.ErrorContains(t, <-errs, "killed after grace period")
+	})
+	t.Run("terminated-by-signal", func(t *testing.T) {
+		var p = NewCommand(exec.Command("sh", "-c", "kill -INT $$"))
+		assert.ErrorContains(t, p.Start(), "terminated by signal interrupt")
+	})
+	t.Run("manager-logger", func(t *testing.T) {
+		var out syncBuffer
+		pman := NewCustomManager(Parameters{Logger: slog.New(slog.NewTextHandler(&out, nil))})
+		pman.AddProcess("sidecar", NewCommand(exec.Command("echo", "hi")))
+
+		terminated := make(chan struct{})
+		go func() {
+			pman.Start()
+			close(terminated)
+		}()
+		changeGear()
+		pman.Stop()
+		assert.NoError(t, waitFor("manager", terminated, time.Second))
+		assert.Contains(t, out.String(), `msg="[process:sidecar]: hi"`)
+	})
+}
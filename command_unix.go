@@ -0,0 +1,42 @@
+//go:build !windows
+// +build !windows
+
+package procman
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+var defaultStopSignal os.Signal = syscall.SIGTERM
+
+// stopKills is true when commands can only be killed when stopping.
+const stopKills = false
+
+// prepareCommand makes the command the leader of a new process group, so it can be signaled along with its children.
+func prepareCommand(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+func signalCommand(cmd *exec.Cmd, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return cmd.Process.Signal(sig)
+	}
+	return syscall.Kill(-cmd.Process.Pid, s)
+}
+
+func killCommand(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func exitSignal(exit *exec.ExitError) (os.Signal, bool) {
+	if status, ok := exit.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return status.Signal(), true
+	}
+	return nil, false
+}
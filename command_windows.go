@@ -0,0 +1,29 @@
+//go:build windows
+// +build windows
+
+package procman
+
+import (
+	"os"
+	"os/exec"
+)
+
+var defaultStopSignal os.Signal = os.Kill
+
+// stopKills is true when commands can only be killed when stopping.
+const stopKills = true
+
+func prepareCommand(cmd *exec.Cmd) {}
+
+// signalCommand kills the command since Windows does not support sending other signals.
+func signalCommand(cmd *exec.Cmd, sig os.Signal) error {
+	return cmd.Process.Kill()
+}
+
+func killCommand(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+func exitSignal(exit *exec.ExitError) (os.Signal, bool) {
+	return nil, false
+}
@@ -1,8 +1,10 @@
 package procman
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"gitlab.com/vredens/go-logger/v2"
@@ -14,6 +16,23 @@ func init() {
 	}
 }
 
+type syncBuffer struct {
+	buf bytes.Buffer
+	mux sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.String()
+}
+
 func flapWings() { // of a honeybee
 	<-time.After(5 * time.Millisecond)
 }
@@ -35,6 +54,15 @@ func waitFor(name string, ch chan struct{}, timeout time.Duration) error {
 	}
 }
 
+func waitReady(r Readier) error {
+	select {
+	case <-r.Ready():
+		return nil
+	case <-time.After(time.Second):
+		return fmt.Errorf("timer expired waiting for ready")
+	}
+}
+
 func waitForSteps(steps []chan struct{}, expire time.Duration) error {
 	for i, step := range steps {
 		select {
@@ -0,0 +1,83 @@
+package procman
+
+import (
+	"fmt"
+	"sync"
+)
+
+type reusable struct {
+	factory  func() Process
+	env      *environment
+	instance Process
+	running  bool
+	pending  bool
+	skip     bool
+	mux      sync.Mutex
+}
+
+// Reusable returns a Process which builds a new instance using the factory every time it is started, so it can be started
+// again after being stopped. This is required for processes which can only be started once, like the ones provided by
+// this package, to be restarted.
+func Reusable(factory func() Process) Process {
+	return &reusable{factory: factory}
+}
+
+func (r *reusable) Start() error {
+	r.mux.Lock()
+	if r.running {
+		r.mux.Unlock()
+		return fmt.Errorf("process is already started")
+	}
+	if r.skip {
+		r.pending, r.skip = false, false
+		r.mux.Unlock()
+		return nil
+	}
+	r.pending = false
+	var instance = r.factory()
+	if p, ok := instance.(managed); ok && r.env != nil {
+		p.manage(*r.env)
+	}
+	r.instance, r.running = instance, true
+	r.mux.Unlock()
+
+	defer func() {
+		r.mux.Lock()
+		r.running = false
+		r.mux.Unlock()
+	}()
+	return instance.Start()
+}
+
+func (r *reusable) Stop() error {
+	r.mux.Lock()
+	if !r.running {
+		r.skip = r.pending
+		r.mux.Unlock()
+		return nil
+	}
+	var instance = r.instance
+	r.mux.Unlock()
+	return instance.Stop()
+}
+
+func (r *reusable) manage(env environment) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.env = &env
+}
+
+// pend marks the process as about to be started, so that if it is stopped before Start is called, Start returns
+// immediately instead of running a process nobody will stop.
+func (r *reusable) pend() {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.pending = true
+}
+
+// current returns the instance last started, if any.
+func (r *reusable) current() Process {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.instance
+}
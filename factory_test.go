@@ -0,0 +1,43 @@
+package procman
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReusable(t *testing.T) {
+	var builds int32
+	var p = Reusable(func() Process {
+		atomic.AddInt32(&builds, 1)
+		return NewWorker(func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		})
+	})
+
+	for i := 0; i < 2; i++ {
+		var steps = makeSteps(2)
+		go func() {
+			assert.Nil(t, p.Start())
+			close(steps[0])
+		}()
+		go func() {
+			flapWings()
+			assert.NotNil(t, p.Start())
+			assert.Nil(t, p.Stop())
+			close(steps[1])
+		}()
+		assert.Nil(t, waitForSteps(steps, time.Second))
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&builds))
+
+	// stopping a process about to be started skips the start
+	p.(*reusable).pend()
+	assert.Nil(t, p.Stop())
+	assert.Nil(t, p.Start())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&builds))
+}
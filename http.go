@@ -0,0 +1,194 @@
+package procman
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Server is a Process which listens on a network address.
+type Server interface {
+	Process
+	Readier
+	// Addr returns the address the server is bound to, or nil if it is not ready yet.
+	Addr() net.Addr
+}
+
+// HTTPServerOptions for tuning HTTP servers.
+type HTTPServerOptions struct {
+	// Listener the server accepts connections from. Defaults to listening on the Addr of the http.Server when started.
+	Listener net.Listener
+	// ShutdownTimeout is the max time to wait, when stopping, for active connections to become idle before closing them.
+	// Defaults to 30 seconds. Stop fails if the server is still running twice the ShutdownTimeout after being stopped.
+	ShutdownTimeout time.Duration
+	// Clock used for the shutdown timeout. Defaults to the manager's clock or the SystemClock.
+	Clock Clock
+}
+
+func (opts *HTTPServerOptions) merge(new HTTPServerOptions) {
+	if new.Listener != nil {
+		opts.Listener = new.Listener
+	}
+	if new.ShutdownTimeout > 0 {
+		opts.ShutdownTimeout = new.ShutdownTimeout
+	}
+	if new.Clock != nil {
+		opts.Clock = new.Clock
+	}
+}
+
+type httpServer struct {
+	runner   *periodical
+	srv      *http.Server
+	opts     HTTPServerOptions
+	addr     atomic.Value
+	ready    chan struct{}
+	drained  chan struct{}
+	shutdown sync.Once
+	inflight int64
+	requests uint64
+}
+
+// NewHTTPServer creates a process which serves HTTP requests using srv, either on its Addr or on the listener set in the
+// options, and serves TLS if srv has a TLSConfig. Stopping it gracefully shuts down srv, falling back to closing it if
+// connections are still active after the ShutdownTimeout. The server is a Drainer which stops accepting connections when
+// drained and reports the number of in-flight requests in its metrics.
+func NewHTTPServer(srv *http.Server, opts ...HTTPServerOptions) Server {
+	h := &httpServer{
+		srv:     srv,
+		ready:   make(chan struct{}),
+		drained: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		h.opts.merge(opt)
+	}
+	if h.opts.ShutdownTimeout <= 0 {
+		h.opts.ShutdownTimeout = 30 * time.Second
+	}
+	var handler = srv.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&h.inflight, 1)
+		atomic.AddUint64(&h.requests, 1)
+		defer atomic.AddInt64(&h.inflight, -1)
+		handler.ServeHTTP(w, r)
+	})
+	h.runner = newPeriodical(0, false, func(ctx context.Context) (time.Duration, error) {
+		return 0, h.serve(ctx)
+	}, PeriodicalOptions{
+		Once:            true,
+		ShutdownTimeout: 2 * h.opts.ShutdownTimeout,
+		Clock:           h.opts.Clock,
+	})
+	return h
+}
+
+func (h *httpServer) Start() error {
+	return h.runner.Start()
+}
+
+func (h *httpServer) Stop() error {
+	return h.runner.Stop()
+}
+
+func (h *httpServer) manage(env environment) {
+	h.runner.manage(env)
+}
+
+func (h *httpServer) Ready() <-chan struct{} {
+	return h.ready
+}
+
+func (h *httpServer) Addr() net.Addr {
+	if addr, ok := h.addr.Load().(net.Addr); ok {
+		return addr
+	}
+	return nil
+}
+
+// Drain stops the server from accepting new connections and closes the idle ones, while letting in-flight requests finish.
+func (h *httpServer) Drain() error {
+	go h.stop()
+	return nil
+}
+
+func (h *httpServer) Drained() <-chan struct{} {
+	return h.drained
+}
+
+// Metrics of the HTTP server.
+func (h *httpServer) Metrics() map[string]float64 {
+	return map[string]float64{
+		"inflight": float64(atomic.LoadInt64(&h.inflight)),
+		"requests": float64(atomic.LoadUint64(&h.requests)),
+	}
+}
+
+// serve listens and serves requests until ctx is canceled or the server fails.
+func (h *httpServer) serve(ctx context.Context) error {
+	var ln = h.opts.Listener
+	if ln == nil {
+		var addr = h.srv.Addr
+		if addr == "" {
+			addr = ":http"
+			if h.srv.TLSConfig != nil {
+				addr = ":https"
+			}
+		}
+		var err error
+		if ln, err = net.Listen("tcp", addr); err != nil {
+			return err
+		}
+	}
+	h.addr.Store(ln.Addr())
+	close(h.ready)
+
+	var served = make(chan error, 1)
+	go func() {
+		if h.srv.TLSConfig != nil {
+			served <- h.srv.ServeTLS(ln, "", "")
+		} else {
+			served <- h.srv.Serve(ln)
+		}
+	}()
+
+	select {
+	case err := <-served:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		// the server is being drained
+		<-h.drained
+		return nil
+	case <-ctx.Done():
+	}
+	h.stop()
+	<-served
+	return nil
+}
+
+// stop gracefully shuts down the server, closing it if the shutdown timeout is exceeded.
+func (h *httpServer) stop() {
+	h.shutdown.Do(func() {
+		defer close(h.drained)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-ctx.Done():
+			case <-h.runner.opts.Clock.After(h.opts.ShutdownTimeout):
+				cancel()
+			}
+		}()
+		if err := h.srv.Shutdown(ctx); err != nil {
+			h.runner.opts.Dbgf("http server shutdown timeout exceeded, closing it")
+			h.srv.Close()
+		}
+	})
+}
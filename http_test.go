@@ -0,0 +1,136 @@
+package procman
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPServer(t *testing.T) {
+	var get = func(addr net.Addr, path string) (string, error) {
+		res, err := http.Get("http://" + addr.String() + path)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		return string(body), err
+	}
+	var mux = http.NewServeMux()
+	var release = make(chan struct{})
+	var slow = make(chan struct{}, 1)
+	mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		slow <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		io.WriteString(w, "slow")
+	})
+
+	t.Run("graceful", func(t *testing.T) {
+		var srv = NewHTTPServer(&http.Server{Addr: "127.0.0.1:0", Handler: mux})
+		assert.Nil(t, srv.Addr())
+
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, srv.Start())
+			close(steps[0])
+		}()
+		assert.Nil(t, waitReady(srv))
+
+		body, err := get(srv.Addr(), "/hello")
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", body)
+
+		var slowBody = make(chan string, 1)
+		go func() {
+			body, _ := get(srv.Addr(), "/slow")
+			slowBody <- body
+		}()
+		<-slow
+		assert.Equal(t, float64(1), srv.(MetricsReporter).Metrics()["inflight"])
+
+		var stopped = make(chan struct{})
+		go func() {
+			assert.Nil(t, srv.Stop())
+			close(stopped)
+		}()
+		flapWings()
+		_, err = get(srv.Addr(), "/hello")
+		assert.Error(t, err, "expected new connections to be refused while shutting down")
+
+		release <- struct{}{}
+		assert.Equal(t, "slow", <-slowBody)
+		assert.Nil(t, waitForSteps(append(steps, stopped), time.Second))
+		assert.Equal(t, float64(2), srv.(MetricsReporter).Metrics()["requests"])
+	})
+
+	t.Run("close-after-shutdown-timeout", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		var srv = NewHTTPServer(&http.Server{Handler: mux}, HTTPServerOptions{Listener: ln, ShutdownTimeout: 50 * time.Millisecond})
+
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, srv.Start())
+			close(steps[0])
+		}()
+		assert.Nil(t, waitReady(srv))
+		assert.Equal(t, ln.Addr(), srv.Addr())
+
+		go get(srv.Addr(), "/slow")
+		<-slow
+
+		assert.Nil(t, srv.Stop())
+		assert.Nil(t, waitForSteps(steps, time.Second))
+	})
+
+	t.Run("drain-in-manager", func(t *testing.T) {
+		var srv = NewHTTPServer(&http.Server{Addr: "127.0.0.1:0", Handler: mux})
+		pman := NewManager()
+		pman.AddProcess("http", srv)
+
+		terminated := make(chan struct{})
+		go func() {
+			pman.Start()
+			close(terminated)
+		}()
+		assert.Nil(t, waitReady(srv))
+		_, scs := pman.StatusCheck()
+		assert.Equal(t, ProcessStateStarted, scs["http"])
+
+		pman.Stop()
+		assert.NoError(t, waitFor("manager", terminated, time.Second))
+		_, scs = pman.StatusCheck()
+		assert.Equal(t, ProcessStateStopped, scs["http"])
+	})
+
+	t.Run("listen-failure", func(t *testing.T) {
+		var srv = NewHTTPServer(&http.Server{Addr: "127.0.0.1:-1"})
+		assert.Error(t, srv.Start())
+	})
+}
+
+func TestReadierState(t *testing.T) {
+	var ctl = &controller{process: &SampleReadier{ready: make(chan struct{})}, state: ProcessStateStarted}
+	assert.Equal(t, ProcessStateStarting, ctl.State())
+	close(ctl.process.(*SampleReadier).ready)
+	assert.Equal(t, ProcessStateStarted, ctl.State())
+}
+
+type SampleReadier struct {
+	SampleService
+	ready chan struct{}
+}
+
+func (sr *SampleReadier) Ready() <-chan struct{} {
+	return sr.ready
+}
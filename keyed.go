@@ -0,0 +1,262 @@
+package procman
+
+import (
+	"context"
+	"hash/fnv"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KeyedWorkerPoolOptions for tuning keyed worker pools.
+type KeyedWorkerPoolOptions[T any] struct {
+	// Shards is the number of workers, each handling the items of the keys assigned to it one at a time.
+	// Defaults to the number of CPUs.
+	Shards int
+	// ShardBuffer is the number of items which can be waiting for each worker. Defaults to 100.
+	ShardBuffer int
+	// Drain, if true, makes Stop wait for the items already buffered in the channel, and waiting for workers, to be
+	// handled, for up to DrainTimeout. Otherwise they are abandoned and in-flight handlers are canceled right away.
+	Drain bool
+	// DrainTimeout is the max time spent draining before abandoning the remaining items. Defaults to half the ShutdownTimeout.
+	DrainTimeout time.Duration
+	// OnUnprocessed is called for each item left unhandled when the pool stops.
+	OnUnprocessed func(item T)
+	// ShutdownTimeout sets the timeout to wait for Start() to finish after Stop() is called. Defaults to 60 seconds.
+	ShutdownTimeout time.Duration
+	// Clock used for the drain and shutdown timeouts. Defaults to the manager's clock or the SystemClock.
+	Clock Clock
+}
+
+func (opts *KeyedWorkerPoolOptions[T]) merge(new KeyedWorkerPoolOptions[T]) {
+	if new.Shards > 0 {
+		opts.Shards = new.Shards
+	}
+	if new.ShardBuffer > 0 {
+		opts.ShardBuffer = new.ShardBuffer
+	}
+	if new.Drain {
+		opts.Drain = new.Drain
+	}
+	if new.DrainTimeout > 0 {
+		opts.DrainTimeout = new.DrainTimeout
+	}
+	if new.OnUnprocessed != nil {
+		opts.OnUnprocessed = new.OnUnprocessed
+	}
+	if new.ShutdownTimeout > 0 {
+		opts.ShutdownTimeout = new.ShutdownTimeout
+	}
+	if new.Clock != nil {
+		opts.Clock = new.Clock
+	}
+}
+
+type keyedWorkerPool[T any] struct {
+	runner      *periodical
+	in          <-chan T
+	key         func(item T) string
+	handle      func(ctx context.Context, item T) error
+	opts        KeyedWorkerPoolOptions[T]
+	shards      []chan T
+	draining    chan struct{}
+	drained     chan struct{}
+	drain       sync.Once
+	processed   uint64
+	unprocessed uint64
+	inflight    int32
+}
+
+// NewKeyedWorkerPool creates a pool of workers which handles the items received from a channel until it is closed or the
+// pool is stopped. Items are assigned to workers by hashing their key, so items with the same key are handled one at a
+// time and in the order they were received, while items with different keys may be handled concurrently. The pool stops
+// with the first error returned by a handler, canceling the others. The pool is a Drainer which stops receiving items
+// when drained, letting the ones already assigned to workers finish, and then returns, leaving the items still buffered
+// unprocessed.
+func NewKeyedWorkerPool[T any](in <-chan T, key func(item T) string, handle func(ctx context.Context, item T) error, opts ...KeyedWorkerPoolOptions[T]) Process {
+	p := &keyedWorkerPool[T]{
+		in:       in,
+		key:      key,
+		handle:   handle,
+		draining: make(chan struct{}),
+		drained:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		p.opts.merge(opt)
+	}
+	if p.opts.Shards < 1 {
+		p.opts.Shards = runtime.NumCPU()
+	}
+	if p.opts.ShardBuffer < 1 {
+		p.opts.ShardBuffer = 100
+	}
+	p.shards = make([]chan T, p.opts.Shards)
+	for i := range p.shards {
+		p.shards[i] = make(chan T, p.opts.ShardBuffer)
+	}
+	p.runner = newPeriodical(0, false, func(ctx context.Context) (time.Duration, error) {
+		return 0, p.run(ctx)
+	}, PeriodicalOptions{
+		Once:            true,
+		ShutdownTimeout: p.opts.ShutdownTimeout,
+		Clock:           p.opts.Clock,
+	})
+	if p.opts.DrainTimeout <= 0 {
+		p.opts.DrainTimeout = p.runner.opts.ShutdownTimeout / 2
+	}
+	return p
+}
+
+func (p *keyedWorkerPool[T]) Start() error {
+	return p.runner.Start()
+}
+
+func (p *keyedWorkerPool[T]) Stop() error {
+	return p.runner.Stop()
+}
+
+func (p *keyedWorkerPool[T]) manage(env environment) {
+	p.runner.manage(env)
+}
+
+func (p *keyedWorkerPool[T]) Drain() error {
+	p.drain.Do(func() {
+		close(p.draining)
+	})
+	return nil
+}
+
+func (p *keyedWorkerPool[T]) Drained() <-chan struct{} {
+	return p.drained
+}
+
+// Metrics of the keyed worker pool, including the backlog of each shard.
+func (p *keyedWorkerPool[T]) Metrics() map[string]float64 {
+	var out = map[string]float64{
+		"backlog":     float64(len(p.in)),
+		"inflight":    float64(atomic.LoadInt32(&p.inflight)),
+		"processed":   float64(atomic.LoadUint64(&p.processed)),
+		"unprocessed": float64(atomic.LoadUint64(&p.unprocessed)),
+	}
+	for i, shard := range p.shards {
+		out["shard_"+strconv.Itoa(i)+"_backlog"] = float64(len(shard))
+	}
+	return out
+}
+
+// shard returns the index of the worker handling the given key.
+func (p *keyedWorkerPool[T]) shard(key string) int {
+	var h = fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(p.shards)))
+}
+
+// run dispatches the items of the channel to the workers until it is closed, ctx is canceled or the pool is drained. The
+// context given to handlers is only canceled once the pool is done draining.
+func (p *keyedWorkerPool[T]) run(ctx context.Context) error {
+	defer close(p.drained)
+	work, abandon := drainContext(ctx, p.opts.Drain, p.opts.DrainTimeout, p.runner, "keyed worker pool")
+	defer abandon()
+
+	var failure error
+	var once sync.Once
+	var fail = func(err error) {
+		once.Do(func() {
+			failure = err
+			abandon()
+		})
+	}
+	var wg sync.WaitGroup
+	for _, shard := range p.shards {
+		wg.Add(1)
+		go func(shard chan T) {
+			defer wg.Done()
+			p.consume(work, shard, fail)
+		}(shard)
+	}
+
+	p.dispatch(ctx, work)
+	for _, shard := range p.shards {
+		close(shard)
+	}
+	wg.Wait()
+	abandon()
+
+	abandonBuffered(p.in, p.abandon)
+	return failure
+}
+
+// dispatch sends items to their workers until the channel is closed, the pool is drained, the work is abandoned or ctx
+// is canceled, in which case the items already buffered are dispatched when draining.
+func (p *keyedWorkerPool[T]) dispatch(ctx, work context.Context) {
+	for {
+		var item T
+		var ok bool
+		select {
+		case <-work.Done():
+			return
+		case <-p.draining:
+			return
+		case <-ctx.Done():
+			if !p.opts.Drain {
+				return
+			}
+			select {
+			case <-p.draining:
+				return
+			case item, ok = <-p.in:
+			default:
+				return
+			}
+		case item, ok = <-p.in:
+		}
+		if !ok {
+			return
+		}
+		if isClosed(p.draining) {
+			p.abandon(item)
+			return
+		}
+		select {
+		case p.shards[p.shard(p.key(item))] <- item:
+		case <-p.draining:
+			p.abandon(item)
+			return
+		case <-work.Done():
+			p.abandon(item)
+			return
+		}
+	}
+}
+
+// consume handles the items of a shard, in order, until it is closed. Items received after the work is abandoned are
+// not handled.
+func (p *keyedWorkerPool[T]) consume(work context.Context, shard chan T, fail func(err error)) {
+	for item := range shard {
+		if work.Err() != nil {
+			p.abandon(item)
+			continue
+		}
+		if err := p.call(work, item); err != nil {
+			fail(err)
+			continue
+		}
+		atomic.AddUint64(&p.processed, 1)
+	}
+}
+
+// call runs the handler, tracking the items in flight.
+func (p *keyedWorkerPool[T]) call(ctx context.Context, item T) error {
+	atomic.AddInt32(&p.inflight, 1)
+	defer atomic.AddInt32(&p.inflight, -1)
+	return safely("keyed worker pool panic", func() error { return p.handle(ctx, item) })
+}
+
+func (p *keyedWorkerPool[T]) abandon(item T) {
+	atomic.AddUint64(&p.unprocessed, 1)
+	if p.opts.OnUnprocessed != nil {
+		p.opts.OnUnprocessed(item)
+	}
+}
@@ -0,0 +1,183 @@
+package procman
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyedWorkerPool(t *testing.T) {
+	type event struct {
+		key string
+		seq int
+	}
+	var fill = func(keys, n int) chan event {
+		var ch = make(chan event, keys*n)
+		for i := 0; i < n; i++ {
+			for k := 0; k < keys; k++ {
+				ch <- event{key: strconv.Itoa(k), seq: i}
+			}
+		}
+		return ch
+	}
+	var key = func(e event) string { return e.key }
+
+	t.Run("per-key-order", func(t *testing.T) {
+		var ch = fill(10, 20)
+		close(ch)
+		var seen = map[string][]int{}
+		var mux sync.Mutex
+		var p = NewKeyedWorkerPool(ch, key, func(ctx context.Context, e event) error {
+			mux.Lock()
+			defer mux.Unlock()
+			seen[e.key] = append(seen[e.key], e.seq)
+			return nil
+		}, KeyedWorkerPoolOptions[event]{Shards: 4})
+		assert.Nil(t, p.Start())
+		assert.Len(t, seen, 10)
+		for k, seqs := range seen {
+			assert.Len(t, seqs, 20, k)
+			for i, seq := range seqs {
+				assert.Equal(t, i, seq, "key %s out of order", k)
+			}
+		}
+		var metrics = p.(MetricsReporter).Metrics()
+		assert.Equal(t, float64(200), metrics["processed"])
+		assert.Contains(t, metrics, "shard_3_backlog")
+	})
+	t.Run("keys-in-parallel", func(t *testing.T) {
+		var ch = make(chan event, 2)
+		var p = NewKeyedWorkerPool(ch, key, func(ctx context.Context, e event) error {
+			if e.key == "blocked" {
+				<-ctx.Done()
+			}
+			return nil
+		}, KeyedWorkerPoolOptions[event]{Shards: 2}).(*keyedWorkerPool[event])
+		var other = "0"
+		for i := 0; p.shard(other) == p.shard("blocked"); i++ {
+			other = strconv.Itoa(i)
+		}
+		ch <- event{key: "blocked"}
+		ch <- event{key: other}
+
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, p.Start())
+			close(steps[0])
+		}()
+		changeGear()
+		assert.Equal(t, float64(1), p.Metrics()["processed"])
+		assert.Equal(t, float64(1), p.Metrics()["inflight"])
+		assert.Nil(t, p.Stop())
+		assert.Nil(t, waitForSteps(steps, time.Second))
+	})
+	t.Run("drain", func(t *testing.T) {
+		var handled, unprocessed int32
+		var p = NewKeyedWorkerPool(fill(4, 5), key, func(ctx context.Context, e event) error {
+			flapWings()
+			if ctx.Err() == nil {
+				atomic.AddInt32(&handled, 1)
+			}
+			return nil
+		}, KeyedWorkerPoolOptions[event]{Shards: 2, ShardBuffer: 1, Drain: true, OnUnprocessed: func(event) { atomic.AddInt32(&unprocessed, 1) }})
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, p.Start())
+			close(steps[0])
+		}()
+		flapWings()
+		assert.Nil(t, p.Stop())
+		assert.Nil(t, waitForSteps(steps, time.Second))
+		assert.Equal(t, int32(20), atomic.LoadInt32(&handled))
+		assert.Equal(t, int32(0), atomic.LoadInt32(&unprocessed))
+	})
+	t.Run("drainer", func(t *testing.T) {
+		var started = make(chan struct{}, 10)
+		var handled, canceled, unprocessed int32
+		var p = NewKeyedWorkerPool(fill(2, 5), key, func(ctx context.Context, e event) error {
+			started <- struct{}{}
+			changeGear()
+			if ctx.Err() != nil {
+				atomic.AddInt32(&canceled, 1)
+			}
+			atomic.AddInt32(&handled, 1)
+			return nil
+		}, KeyedWorkerPoolOptions[event]{Shards: 2, ShardBuffer: 1, OnUnprocessed: func(event) { atomic.AddInt32(&unprocessed, 1) }})
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, p.Start())
+			close(steps[0])
+		}()
+		<-started
+		<-started
+		assert.Nil(t, p.(Drainer).Drain())
+		select {
+		case <-p.(Drainer).Drained():
+		case <-time.After(time.Second):
+			t.Fatal("keyed worker pool was not drained")
+		}
+		assert.Nil(t, waitForSteps(steps, time.Second))
+		// the items already assigned to workers are handled, the others are left
+		assert.Equal(t, int32(0), atomic.LoadInt32(&canceled))
+		assert.Equal(t, int32(10), atomic.LoadInt32(&handled)+atomic.LoadInt32(&unprocessed))
+		assert.GreaterOrEqual(t, atomic.LoadInt32(&unprocessed), int32(6))
+	})
+	t.Run("abandon", func(t *testing.T) {
+		var handled, unprocessed int32
+		var p = NewKeyedWorkerPool(fill(1, 10), key, func(ctx context.Context, e event) error {
+			atomic.AddInt32(&handled, 1)
+			<-ctx.Done()
+			return nil
+		}, KeyedWorkerPoolOptions[event]{Shards: 2, OnUnprocessed: func(event) { atomic.AddInt32(&unprocessed, 1) }})
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, p.Start())
+			close(steps[0])
+		}()
+		flapWings()
+		assert.Nil(t, p.Stop())
+		assert.Nil(t, waitForSteps(steps, time.Second))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&handled))
+		assert.Equal(t, int32(9), atomic.LoadInt32(&unprocessed))
+	})
+	t.Run("failure", func(t *testing.T) {
+		var ch = make(chan event, 1)
+		var canceled int32
+		var p = NewKeyedWorkerPool(ch, key, func(ctx context.Context, e event) error {
+			if e.key == "bad" {
+				return fmt.Errorf("bad event")
+			}
+			<-ctx.Done()
+			atomic.StoreInt32(&canceled, 1)
+			return nil
+		}, KeyedWorkerPoolOptions[event]{Shards: 2}).(*keyedWorkerPool[event])
+		var good = "0"
+		for i := 0; p.shard(good) == p.shard("bad"); i++ {
+			good = strconv.Itoa(i)
+		}
+		var steps = makeSteps(1)
+		go func() {
+			assert.ErrorContains(t, p.Start(), "bad event")
+			close(steps[0])
+		}()
+		ch <- event{key: good}
+		flapWings()
+		ch <- event{key: "bad"}
+		assert.Nil(t, waitForSteps(steps, time.Second))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&canceled))
+	})
+	t.Run("panic", func(t *testing.T) {
+		var ch = make(chan event, 1)
+		ch <- event{key: "a"}
+		var p = NewKeyedWorkerPool(ch, key, func(ctx context.Context, e event) error {
+			panic("oops")
+		})
+		assert.ErrorContains(t, p.Start(), "keyed worker pool panic")
+	})
+}
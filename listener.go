@@ -0,0 +1,245 @@
+package procman
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ListenerServerOptions for tuning listener servers.
+type ListenerServerOptions struct {
+	// DrainTimeout is the max time given to open connections to finish, after the server stops accepting new ones, before
+	// they are closed. Defaults to half the ShutdownTimeout.
+	DrainTimeout time.Duration
+	// ShutdownTimeout sets the timeout to wait for Start() to finish after Stop() is called. Defaults to 60 seconds.
+	ShutdownTimeout time.Duration
+	// Clock used for the drain and shutdown timeouts. Defaults to the manager's clock or the SystemClock.
+	Clock Clock
+}
+
+func (opts *ListenerServerOptions) merge(new ListenerServerOptions) {
+	if new.DrainTimeout > 0 {
+		opts.DrainTimeout = new.DrainTimeout
+	}
+	if new.ShutdownTimeout > 0 {
+		opts.ShutdownTimeout = new.ShutdownTimeout
+	}
+	if new.Clock != nil {
+		opts.Clock = new.Clock
+	}
+}
+
+type listenerServer struct {
+	runner   *periodical
+	ln       net.Listener
+	handle   func(ctx context.Context, conn net.Conn)
+	opts     ListenerServerOptions
+	ready    chan struct{}
+	drained  chan struct{}
+	closing  sync.Once
+	conns    map[net.Conn]struct{}
+	accepted uint64
+	cut      uint64
+	mux      sync.Mutex
+}
+
+// NewListenerServer creates a process which accepts connections from ln and handles each one in its own go routine,
+// closing it once handle returns. The context given to handlers is canceled when the server is stopped, at which point
+// it stops accepting connections and gives the open ones up to the DrainTimeout to finish before closing them. The
+// number of connections closed this way is reported in the metrics. The server is a Drainer which stops accepting
+// connections when drained.
+func NewListenerServer(ln net.Listener, handle func(ctx context.Context, conn net.Conn), opts ...ListenerServerOptions) Server {
+	s := &listenerServer{
+		ln:      ln,
+		handle:  handle,
+		ready:   make(chan struct{}),
+		drained: make(chan struct{}),
+		conns:   make(map[net.Conn]struct{}),
+	}
+	for _, opt := range opts {
+		s.opts.merge(opt)
+	}
+	s.runner = newPeriodical(0, false, func(ctx context.Context) (time.Duration, error) {
+		return 0, s.serve(ctx)
+	}, PeriodicalOptions{
+		Once:            true,
+		ShutdownTimeout: s.opts.ShutdownTimeout,
+		Clock:           s.opts.Clock,
+	})
+	if s.opts.DrainTimeout <= 0 {
+		s.opts.DrainTimeout = s.runner.opts.ShutdownTimeout / 2
+	}
+	return s
+}
+
+func (s *listenerServer) Start() error {
+	return s.runner.Start()
+}
+
+func (s *listenerServer) Stop() error {
+	return s.runner.Stop()
+}
+
+func (s *listenerServer) manage(env environment) {
+	s.runner.manage(env)
+}
+
+func (s *listenerServer) Ready() <-chan struct{} {
+	return s.ready
+}
+
+func (s *listenerServer) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Drain stops the server from accepting new connections while letting the open ones finish.
+func (s *listenerServer) Drain() error {
+	s.close()
+	return nil
+}
+
+func (s *listenerServer) Drained() <-chan struct{} {
+	return s.drained
+}
+
+// Metrics of the listener server.
+func (s *listenerServer) Metrics() map[string]float64 {
+	s.mux.Lock()
+	var open = len(s.conns)
+	s.mux.Unlock()
+	return map[string]float64{
+		"connections": float64(open),
+		"accepted":    float64(atomic.LoadUint64(&s.accepted)),
+		"cut":         float64(atomic.LoadUint64(&s.cut)),
+	}
+}
+
+// serve accepts connections until ctx is canceled, the server is drained or the listener fails, and then waits for the
+// open connections to finish.
+func (s *listenerServer) serve(ctx context.Context) error {
+	defer close(s.drained)
+	close(s.ready)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.close()
+		case <-s.drained:
+		}
+	}()
+
+	var failure error
+	var once sync.Once
+	var fail = func(err error) {
+		once.Do(func() {
+			failure = err
+			s.close()
+		})
+	}
+
+	var handlers sync.WaitGroup
+	var delay time.Duration
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if temporaryAcceptError(err) {
+				// back off like http.Server does, the listener is closed when stopping so Accept fails right after
+				delay = min(max(2*delay, 5*time.Millisecond), time.Second)
+				s.runner.opts.Dbgf("listener server accept error, retrying in %s: %v", delay, err)
+				select {
+				case <-s.runner.opts.Clock.After(delay):
+				case <-ctx.Done():
+				}
+				continue
+			}
+			if !errors.Is(err, net.ErrClosed) {
+				fail(err)
+			}
+			break
+		}
+		delay = 0
+		atomic.AddUint64(&s.accepted, 1)
+		s.track(conn, true)
+		handlers.Add(1)
+		go func() {
+			defer handlers.Done()
+			defer s.track(conn, false)
+			if err := s.call(ctx, conn); err != nil {
+				fail(err)
+			}
+		}()
+	}
+
+	var done = make(chan struct{})
+	go func() {
+		handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		select {
+		case <-done:
+		case <-s.runner.opts.Clock.After(s.opts.DrainTimeout):
+			if n := s.cutAll(); n > 0 {
+				s.runner.opts.Dbgf("listener server drain timeout exceeded, closed %d connections", n)
+			}
+			<-done
+		}
+	}
+	return failure
+}
+
+// temporaryAcceptError returns true for the errors Accept may recover from, such as running out of file descriptors or
+// a connection aborted before being accepted.
+func temporaryAcceptError(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EMFILE, syscall.ENFILE, syscall.ENOBUFS, syscall.ENOMEM, syscall.ECONNABORTED, syscall.ECONNRESET, syscall.EINTR} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr) && nerr.Timeout()
+}
+
+// call runs the handler of a connection.
+func (s *listenerServer) call(ctx context.Context, conn net.Conn) error {
+	return safely("listener server panic", func() error {
+		s.handle(ctx, conn)
+		return nil
+	})
+}
+
+// track adds or removes an open connection, closing it when removed.
+func (s *listenerServer) track(conn net.Conn, open bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if open {
+		s.conns[conn] = struct{}{}
+		return
+	}
+	delete(s.conns, conn)
+	conn.Close()
+}
+
+// cutAll closes every open connection and returns how many there were.
+func (s *listenerServer) cutAll() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	atomic.AddUint64(&s.cut, uint64(len(s.conns)))
+	return len(s.conns)
+}
+
+// close stops accepting connections.
+func (s *listenerServer) close() {
+	s.closing.Do(func() {
+		s.ln.Close()
+	})
+}
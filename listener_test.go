@@ -0,0 +1,193 @@
+package procman
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenerServer(t *testing.T) {
+	var listen = func(t *testing.T) net.Listener {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		return ln
+	}
+	var echo = func(ctx context.Context, conn net.Conn) {
+		var scanner = bufio.NewScanner(conn)
+		for scanner.Scan() {
+			conn.Write(append(scanner.Bytes(), '\n'))
+		}
+	}
+
+	t.Run("echo", func(t *testing.T) {
+		var srv = NewListenerServer(listen(t), echo)
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, srv.Start())
+			close(steps[0])
+		}()
+		assert.Nil(t, waitReady(srv))
+
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		assert.NoError(t, err)
+		conn.Write([]byte("ping\n"))
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "ping\n", line)
+		assert.Equal(t, float64(1), srv.(MetricsReporter).Metrics()["connections"])
+		conn.Close()
+		flapWings()
+		assert.Equal(t, float64(0), srv.(MetricsReporter).Metrics()["connections"])
+
+		assert.Nil(t, srv.Stop())
+		assert.Nil(t, waitForSteps(steps, time.Second))
+		_, err = net.Dial("tcp", srv.Addr().String())
+		assert.Error(t, err)
+	})
+
+	t.Run("cooperative-handlers", func(t *testing.T) {
+		var srv = NewListenerServer(listen(t), func(ctx context.Context, conn net.Conn) {
+			<-ctx.Done()
+		})
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, srv.Start())
+			close(steps[0])
+		}()
+		assert.Nil(t, waitReady(srv))
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		assert.NoError(t, err)
+		defer conn.Close()
+		flapWings()
+
+		assert.Nil(t, srv.Stop())
+		assert.Nil(t, waitForSteps(steps, time.Second))
+		var metrics = srv.(MetricsReporter).Metrics()
+		assert.Equal(t, float64(1), metrics["accepted"])
+		assert.Equal(t, float64(0), metrics["cut"])
+	})
+
+	t.Run("cut-after-drain-timeout", func(t *testing.T) {
+		var srv = NewListenerServer(listen(t), echo, ListenerServerOptions{DrainTimeout: 50 * time.Millisecond})
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, srv.Start())
+			close(steps[0])
+		}()
+		assert.Nil(t, waitReady(srv))
+		for i := 0; i < 2; i++ {
+			conn, err := net.Dial("tcp", srv.Addr().String())
+			assert.NoError(t, err)
+			defer conn.Close()
+		}
+		flapWings()
+
+		assert.Nil(t, srv.Stop())
+		assert.Nil(t, waitForSteps(steps, time.Second))
+		assert.Equal(t, float64(2), srv.(MetricsReporter).Metrics()["cut"])
+	})
+
+	t.Run("drain-in-manager", func(t *testing.T) {
+		var srv = NewListenerServer(listen(t), echo)
+		pman := NewManager()
+		pman.AddProcess("tcp", srv)
+
+		terminated := make(chan struct{})
+		go func() {
+			pman.Start()
+			close(terminated)
+		}()
+		assert.Nil(t, waitReady(srv))
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		assert.NoError(t, err)
+		flapWings()
+
+		go pman.Stop()
+		changeGear()
+		_, err = net.Dial("tcp", srv.Addr().String())
+		assert.Error(t, err, "expected new connections to be refused while draining")
+		select {
+		case <-terminated:
+			t.Error("expected manager to wait for the open connection to drain")
+		default:
+		}
+
+		conn.Close()
+		assert.NoError(t, waitFor("manager", terminated, time.Second))
+		assert.Equal(t, float64(0), srv.(MetricsReporter).Metrics()["cut"])
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		var srv = NewListenerServer(listen(t), func(ctx context.Context, conn net.Conn) {
+			panic("oops")
+		})
+		var errs = make(chan error, 1)
+		go func() {
+			errs <- srv.Start()
+		}()
+		assert.Nil(t, waitReady(srv))
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		assert.NoError(t, err)
+		defer conn.Close()
+		select {
+		case err := <-errs:
+			assert.ErrorContains(t, err, "listener server panic")
+		case <-time.After(time.Second):
+			t.Error("expected the server to fail")
+		}
+	})
+
+	t.Run("temporary-accept-errors", func(t *testing.T) {
+		var ln = &flakyListener{Listener: listen(t), errs: []error{
+			&os.SyscallError{Syscall: "accept", Err: syscall.EMFILE},
+			&os.SyscallError{Syscall: "accept", Err: syscall.ECONNABORTED},
+		}}
+		var srv = NewListenerServer(ln, func(ctx context.Context, conn net.Conn) {
+			conn.Write([]byte("hi\n"))
+		})
+		var errs = make(chan error, 1)
+		go func() {
+			errs <- srv.Start()
+		}()
+		assert.Nil(t, waitReady(srv))
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		assert.NoError(t, err)
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "hi\n", line)
+		conn.Close()
+		assert.Nil(t, srv.Stop())
+		assert.Nil(t, <-errs)
+	})
+	t.Run("permanent-accept-error", func(t *testing.T) {
+		var ln = &flakyListener{Listener: listen(t), errs: []error{errDefault}}
+		var srv = NewListenerServer(ln, func(ctx context.Context, conn net.Conn) {})
+		assert.ErrorIs(t, srv.Start(), errDefault)
+	})
+}
+
+// flakyListener fails to accept connections with the given errors before accepting them.
+type flakyListener struct {
+	net.Listener
+	errs []error
+	mux  sync.Mutex
+}
+
+func (ln *flakyListener) Accept() (net.Conn, error) {
+	ln.mux.Lock()
+	if len(ln.errs) > 0 {
+		var err = ln.errs[0]
+		ln.errs = ln.errs[1:]
+		ln.mux.Unlock()
+		return nil, err
+	}
+	ln.mux.Unlock()
+	return ln.Listener.Accept()
+}
@@ -0,0 +1,125 @@
+package procman
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// environment variables set by systemd for socket activation
+	envListenPID     = "LISTEN_PID"
+	envListenFDs     = "LISTEN_FDS"
+	envListenFDNames = "LISTEN_FDNAMES"
+	// environment variables set by a parent process, such as a manager being upgraded, for the listeners it passes on
+	envInheritedFDs     = "PROCMAN_LISTEN_FDS"
+	envInheritedFDNames = "PROCMAN_LISTEN_FDNAMES"
+	// first file descriptor passed on, after stdin, stdout and stderr
+	listenFDsStart = 3
+)
+
+// inherited holds the listeners passed on to this process, which are only collected once since the environment
+// variables describing them are removed so they are not passed on to child processes.
+var inherited struct {
+	once      sync.Once
+	listeners map[string][]net.Listener
+	err       error
+	mux       sync.Mutex
+}
+
+// takeInherited returns the first inherited listener with the given name which was not taken yet.
+func takeInherited(name string) (net.Listener, bool, error) {
+	inherited.once.Do(func() {
+		count, names := inheritedFDs(os.Getenv)
+		for _, env := range []string{envListenPID, envListenFDs, envListenFDNames, envInheritedFDs, envInheritedFDNames} {
+			os.Unsetenv(env)
+		}
+		inherited.listeners, inherited.err = inheritListeners(listenFDsStart, count, names)
+	})
+
+	inherited.mux.Lock()
+	defer inherited.mux.Unlock()
+	if inherited.err != nil {
+		return nil, false, inherited.err
+	}
+	listeners := inherited.listeners[name]
+	if len(listeners) == 0 {
+		return nil, false, nil
+	}
+	inherited.listeners[name] = listeners[1:]
+	return listeners[0], true, nil
+}
+
+// inheritedFDs returns the number of file descriptors passed on to this process, either by systemd socket activation or
+// by a parent process, and their names. File descriptors without a name are named "unknown", like systemd does.
+func inheritedFDs(getenv func(key string) string) (int, []string) {
+	var fds, fdNames = getenv(envInheritedFDs), getenv(envInheritedFDNames)
+	if pid := getenv(envListenPID); pid != "" {
+		if pid != strconv.Itoa(os.Getpid()) {
+			return 0, nil
+		}
+		fds, fdNames = getenv(envListenFDs), getenv(envListenFDNames)
+	}
+	count, err := strconv.Atoi(fds)
+	if err != nil || count < 1 {
+		return 0, nil
+	}
+	var names = make([]string, count)
+	var given = strings.Split(fdNames, ":")
+	for i := range names {
+		names[i] = "unknown"
+		if i < len(given) && given[i] != "" {
+			names[i] = given[i]
+		}
+	}
+	return count, names
+}
+
+// inheritListeners converts count file descriptors, starting at first, into listeners indexed by name.
+func inheritListeners(first, count int, names []string) (map[string][]net.Listener, error) {
+	var listeners = map[string][]net.Listener{}
+	for i := 0; i < count; i++ {
+		var file = inheritFile(first+i, names[i])
+		if file == nil {
+			continue
+		}
+		ln, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, taken := range listeners {
+				for _, ln := range taken {
+					ln.Close()
+				}
+			}
+			return nil, fmt.Errorf("inherited file descriptor %d (%s) is not a listener; %w", first+i, names[i], err)
+		}
+		listeners[names[i]] = append(listeners[names[i]], ln)
+	}
+	return listeners, nil
+}
+
+// Listen returns the listener with the given name passed on to this process by systemd socket activation, matched by
+// the names in LISTEN_FDNAMES, or by a parent manager being upgraded. If there is none, it listens on the given network
+// address. Listeners are owned by the manager, which hands them over when upgrading, and each name can only be taken once.
+func (manager *Manager) Listen(name, network, address string) (net.Listener, error) {
+	manager.mux.Lock()
+	defer manager.mux.Unlock()
+
+	if _, ok := manager.listeners[name]; ok {
+		return nil, fmt.Errorf("listener %s was already taken", name)
+	}
+	ln, ok, err := takeInherited(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if ln, err = net.Listen(network, address); err != nil {
+			return nil, err
+		}
+	}
+	manager.listeners[name] = ln
+	return ln, nil
+}
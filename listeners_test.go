@@ -0,0 +1,99 @@
+//go:build !windows
+// +build !windows
+
+package procman
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInheritedListeners(t *testing.T) {
+	var env = func(vars map[string]string) func(string) string {
+		return func(key string) string { return vars[key] }
+	}
+	// dup returns a new file descriptor for the given file, which can be inherited without affecting the original
+	var dup = func(t *testing.T, f *os.File) int {
+		fd, err := syscall.Dup(int(f.Fd()))
+		assert.NoError(t, err)
+		return fd
+	}
+
+	t.Run("systemd", func(t *testing.T) {
+		count, names := inheritedFDs(env(map[string]string{
+			envListenPID:     strconv.Itoa(os.Getpid()),
+			envListenFDs:     "3",
+			envListenFDNames: "http:metrics",
+		}))
+		assert.Equal(t, 3, count)
+		assert.Equal(t, []string{"http", "metrics", "unknown"}, names)
+	})
+	t.Run("systemd-other-process", func(t *testing.T) {
+		count, _ := inheritedFDs(env(map[string]string{
+			envListenPID: strconv.Itoa(os.Getpid() + 1),
+			envListenFDs: "1",
+		}))
+		assert.Equal(t, 0, count)
+	})
+	t.Run("parent", func(t *testing.T) {
+		count, names := inheritedFDs(env(map[string]string{
+			envInheritedFDs:     "2",
+			envInheritedFDNames: "http:grpc",
+		}))
+		assert.Equal(t, 2, count)
+		assert.Equal(t, []string{"http", "grpc"}, names)
+	})
+	t.Run("none", func(t *testing.T) {
+		count, _ := inheritedFDs(env(nil))
+		assert.Equal(t, 0, count)
+	})
+	t.Run("listeners", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer ln.Close()
+		f, err := ln.(*net.TCPListener).File()
+		assert.NoError(t, err)
+		var fd = dup(t, f)
+		f.Close()
+
+		listeners, err := inheritListeners(fd, 1, []string{"http"})
+		assert.NoError(t, err)
+		assert.Len(t, listeners["http"], 1)
+		var inherited = listeners["http"][0]
+		defer inherited.Close()
+		assert.Equal(t, ln.Addr().String(), inherited.Addr().String())
+
+		go func() {
+			if conn, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+				conn.Close()
+			}
+		}()
+		conn, err := inherited.Accept()
+		assert.NoError(t, err)
+		conn.Close()
+	})
+	t.Run("not-a-listener", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		assert.NoError(t, err)
+		defer r.Close()
+		defer w.Close()
+
+		_, err = inheritListeners(dup(t, r), 1, []string{"pipe"})
+		assert.ErrorContains(t, err, "(pipe) is not a listener")
+	})
+}
+
+func TestManagerListen(t *testing.T) {
+	pman := NewManager()
+	ln, err := pman.Listen("http", "tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	_, err = pman.Listen("http", "tcp", "127.0.0.1:0")
+	assert.ErrorContains(t, err, "already taken")
+}
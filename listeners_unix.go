@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package procman
+
+import (
+	"os"
+	"syscall"
+)
+
+// inheritFile returns the inherited file descriptor fd as a file, making sure it is not passed on to child processes.
+func inheritFile(fd int, name string) *os.File {
+	syscall.CloseOnExec(fd)
+	return os.NewFile(uintptr(fd), name)
+}
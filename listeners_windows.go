@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package procman
+
+import (
+	"os"
+)
+
+// inheritFile returns nil since file descriptors can not be inherited on Windows.
+func inheritFile(fd int, name string) *os.File {
+	return nil
+}
@@ -3,12 +3,16 @@
 package procman
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"net"
 	"os"
 	"os/signal"
+	"runtime/pprof"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"gitlab.com/vredens/go-logger/v2"
 )
@@ -16,9 +20,15 @@ import (
 // Manager handles your processes.
 type Manager struct {
 	processes map[string]*controller
+	limiters  map[string]*rateLimiter
+	listeners map[string]net.Listener
 	control   chan int
 	mlog      logger.SLogger
 	plog      logger.SLogger
+	clock     Clock
+	drain     time.Duration
+	upgrade   time.Duration
+	upgradeOn os.Signal
 	started   uint32
 	mux       sync.RWMutex
 }
@@ -28,6 +38,37 @@ type Parameters struct {
 	// Logger for the different stages the manager and each process go through.
 	// Defaults to slog.Default().
 	Logger *slog.Logger
+	// Clock used by the manager and given to the processes provided by this package which do not have their own.
+	// Defaults to SystemClock().
+	Clock Clock
+	// DrainTimeout is the maximum time to wait, when stopping, for processes implementing Drainer to finish their ongoing
+	// work before they are stopped. Defaults to 30 seconds.
+	DrainTimeout time.Duration
+	// UpgradeSignal, when set, makes the manager start a new instance of the binary when receiving it, such as SIGUSR2,
+	// handing over the listeners taken with Listen, and stop once the new instance is ready. Defaults to nil which
+	// disables upgrades.
+	UpgradeSignal os.Signal
+	// UpgradeTimeout is the maximum time to wait for a new instance of the binary, started when receiving the
+	// UpgradeSignal, to be ready before giving up on the upgrade. Defaults to 60 seconds.
+	UpgradeTimeout time.Duration
+}
+
+// ProcessOptions for a single process added to the manager.
+type ProcessOptions struct {
+	// HeartbeatTimeout is the maximum time a started process may go without calling Heartbeat before being considered
+	// stuck. Defaults to 0 which disables the watchdog for the process.
+	HeartbeatTimeout time.Duration
+	// OnStuck is the action taken when the process is considered stuck. Defaults to StuckLog.
+	OnStuck StuckAction
+}
+
+func (opts *ProcessOptions) merge(o ProcessOptions) {
+	if o.HeartbeatTimeout > 0 {
+		opts.HeartbeatTimeout = o.HeartbeatTimeout
+	}
+	if o.OnStuck != StuckLog {
+		opts.OnStuck = o.OnStuck
+	}
 }
 
 // NewManager instance using default parameters.
@@ -40,9 +81,24 @@ func NewCustomManager(params Parameters) *Manager {
 	if params.Logger == nil {
 		params.Logger = slog.Default()
 	}
+	if params.Clock == nil {
+		params.Clock = SystemClock()
+	}
+	if params.DrainTimeout <= 0 {
+		params.DrainTimeout = 30 * time.Second
+	}
+	if params.UpgradeTimeout <= 0 {
+		params.UpgradeTimeout = 60 * time.Second
+	}
 	return &Manager{
+		clock:     params.Clock,
+		drain:     params.DrainTimeout,
+		upgrade:   params.UpgradeTimeout,
+		upgradeOn: params.UpgradeSignal,
 		control:   make(chan int),
 		processes: make(map[string]*controller),
+		limiters:  make(map[string]*rateLimiter),
+		listeners: make(map[string]net.Listener),
 		mlog:      logger.NewSLogWrapper(params.Logger).WithTags("pman", "manager"),
 		plog:      logger.NewSLogWrapper(params.Logger).WithTags("pman", "process"),
 	}
@@ -54,21 +110,58 @@ func (manager *Manager) IsStarted() bool {
 }
 
 // AddProcess stores a proces in the list of processes controlled by the ProcessManager.
-func (manager *Manager) AddProcess(name string, process Process) {
+func (manager *Manager) AddProcess(name string, process Process, opts ...ProcessOptions) {
 	if manager.IsStarted() {
 		panic("can not add processes after start")
 	}
 
-	manager.processes[name] = &controller{
-		process: process,
-		control: make(chan int),
-		state:   ProcessStateReady,
+	pController := &controller{
+		process:   process,
+		control:   make(chan int),
+		state:     ProcessStateReady,
+		heartbeat: &heartbeat{clock: manager.clock},
+	}
+	for _, o := range opts {
+		pController.opts.merge(o)
 	}
+	if _, ok := process.(*reusable); !ok && pController.opts.OnStuck == StuckRestart {
+		panic(fmt.Sprintf("process %s can not be restarted when stuck", name))
+	}
+	if p, ok := process.(managed); ok {
+		p.manage(environment{
+			name:    name,
+			clock:   manager.clock,
+			ctx:     context.WithValue(context.Background(), heartbeatKey{}, pController.heartbeat),
+			log:     manager.plog,
+			limiter: manager.limiter,
+			signals: manager.handledSignals(),
+		})
+	}
+	manager.processes[name] = pController
+}
+
+// AddProcessFactory stores a process factory in the list of processes controlled by the ProcessManager. A new process is
+// built by the factory every time it is started, which allows it to be restarted.
+func (manager *Manager) AddProcessFactory(name string, factory func() Process, opts ...ProcessOptions) {
+	manager.AddProcess(name, Reusable(factory), opts...)
 }
 
 func (manager *Manager) launch(name string, pController *controller) {
 	atomic.StoreInt32(&pController.state, ProcessStateStarted)
-	if err := pController.Start(); err != nil {
+	atomic.StoreInt32(&pController.stuck, 0)
+	pController.heartbeat.beat()
+	var err error
+	pprof.Do(context.Background(), pprof.Labels(labelProcess, name), func(context.Context) {
+		err = pController.Start()
+	})
+	if err == nil && atomic.CompareAndSwapInt32(&pController.abort, 1, 0) {
+		err = fmt.Errorf("process aborted after being stuck")
+	}
+	if err != nil && atomic.LoadInt32(&pController.restarting) == 1 {
+		manager.plog.Debugf("[process:%s]: returned when restarting (cause: %+v)", name, err)
+		err = nil
+	}
+	if err != nil {
 		manager.Stop()
 		manager.plog.Errorf("[process:%s]: aborted (cause: %+v)", name, err)
 		atomic.StoreInt32(&pController.state, ProcessStateAborted)
@@ -79,6 +172,15 @@ func (manager *Manager) launch(name string, pController *controller) {
 	}
 }
 
+// handledSignals returns the signals the manager listens for once started.
+func (manager *Manager) handledSignals() []os.Signal {
+	var handled = append([]os.Signal(nil), signals...)
+	if manager.upgradeOn != nil {
+		handled = append(handled, manager.upgradeOn)
+	}
+	return handled
+}
+
 // Start blocks until it receives a signal in its control channel or a SIGTERM,
 // SIGINT or SIGUSR1, and should be the last method in your main.
 func (manager *Manager) Start() error {
@@ -92,44 +194,180 @@ func (manager *Manager) Start() error {
 	// listen for termination signals
 	termChan := make(chan os.Signal, 1)
 	signal.Notify(termChan, signals...)
+	upgradeChan := make(chan os.Signal, 1)
+	if manager.upgradeOn != nil {
+		signal.Notify(upgradeChan, manager.upgradeOn)
+		defer signal.Stop(upgradeChan)
+	}
 
 	manager.mux.Lock()
 	manager.mlog.Infof("process manager: starting [nprocs:%d]", len(manager.processes))
 	for name, process := range manager.processes {
 		manager.plog.Infof("[process:%s]: starting", name)
+		process.pend()
 		go manager.launch(name, process)
 		manager.plog.Debugf("[process:%s]: started", name)
 	}
 	manager.mlog.Infof("process manager: started [nprocs:%d]", len(manager.processes))
 	manager.mux.Unlock()
 
-	select {
-	case signal := <-termChan:
-		manager.mlog.Infof("received signal: %s", signal.String())
-	case <-manager.control:
-		manager.mlog.Info("received stop")
+	watchdogDone, watchdogStopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(watchdogStopped)
+		manager.watchdog(watchdogDone)
+	}()
+
+	readyDone := make(chan struct{})
+	go manager.notifyReady(readyDone)
+
+	upgraded := make(chan error, 1)
+	for upgrading, waiting := false, true; waiting; {
+		select {
+		case signal := <-termChan:
+			manager.mlog.Infof("received signal: %s", signal.String())
+			waiting = false
+		case <-manager.control:
+			manager.mlog.Info("received stop")
+			waiting = false
+		case signal := <-upgradeChan:
+			manager.mlog.Infof("received signal: %s", signal.String())
+			if upgrading {
+				manager.mlog.Info("process manager: already upgrading")
+				continue
+			}
+			upgrading = true
+			go func() {
+				upgraded <- manager.upgradeBinary()
+			}()
+		case err := <-upgraded:
+			upgrading = false
+			if err != nil {
+				manager.mlog.Errorf("process manager: upgrade failed (cause: %+v)", err)
+				continue
+			}
+			manager.mlog.Info("process manager: upgraded")
+			waiting = false
+		}
 	}
+	close(readyDone)
 
 	if !atomic.CompareAndSwapUint32(&manager.started, 1, 0) {
 		manager.mlog.Error("failed to change state to 'stopped'")
 	}
+	close(watchdogDone)
+	<-watchdogStopped
+
+	manager.drainAll()
 
 	manager.mlog.Infof("process manager: stopping [nprocs:%d]", len(manager.processes))
 	for name, process := range manager.processes {
-		manager.plog.Infof("[process:%s]: stopping", name)
-		if err := process.Stop(); err != nil {
-			manager.plog.Errorf("[process:%s]: failed to stop (cause: %+v)", name, err)
-		} else {
-			manager.plog.Debugf("[process:%s]: waiting", name)
-			<-process.control
-			manager.plog.Infof("[process:%s]: stopped", name)
-		}
+		manager.shutdown(name, process)
 	}
 	manager.mlog.Infof("process manager: stopping [nprocs:%d]", len(manager.processes))
 
 	return nil
 }
 
+// drainAll tells every started process implementing Drainer to stop taking new work and waits for them to drain, up to
+// the drain timeout.
+func (manager *Manager) drainAll() {
+	var drained = map[string]<-chan struct{}{}
+	for name, process := range manager.processes {
+		drainer, ok := process.target().(Drainer)
+		if !ok || atomic.LoadInt32(&process.state) != ProcessStateStarted {
+			continue
+		}
+		manager.plog.Infof("[process:%s]: draining", name)
+		if err := drainer.Drain(); err != nil {
+			manager.plog.Errorf("[process:%s]: failed to drain (cause: %+v)", name, err)
+			continue
+		}
+		drained[name] = drainer.Drained()
+	}
+	if len(drained) == 0 {
+		return
+	}
+
+	manager.mlog.Infof("process manager: draining [nprocs:%d]", len(drained))
+	var timeout = manager.clock.After(manager.drain)
+	for name, ch := range drained {
+		select {
+		case <-ch:
+			manager.plog.Infof("[process:%s]: drained", name)
+		case <-timeout:
+			manager.mlog.Errorf("process manager: drain timeout exceeded [timeout:%s]", manager.drain)
+			return
+		}
+	}
+}
+
+func (manager *Manager) shutdown(name string, process *controller) {
+	process.mux.Lock()
+	defer process.mux.Unlock()
+
+	if atomic.CompareAndSwapInt32(&process.halted, 1, 0) {
+		// the process returned during a restart which did not launch it again
+		manager.plog.Infof("[process:%s]: stopped", name)
+		return
+	}
+	switch atomic.LoadInt32(&process.state) {
+	case ProcessStateStopped, ProcessStateAborted:
+		// the process already returned and is only waiting for us to acknowledge it
+		<-process.control
+		manager.plog.Infof("[process:%s]: stopped", name)
+		return
+	}
+	manager.plog.Infof("[process:%s]: stopping", name)
+	if err := process.Stop(); err != nil {
+		manager.plog.Errorf("[process:%s]: failed to stop (cause: %+v)", name, err)
+	} else {
+		manager.plog.Debugf("[process:%s]: waiting", name)
+		<-process.control
+		manager.plog.Infof("[process:%s]: stopped", name)
+	}
+}
+
+// Restart stops the named process, waits for it to return and starts it again. Only processes added using
+// AddProcessFactory, or wrapped with Reusable, can be restarted.
+func (manager *Manager) Restart(name string) error {
+	manager.mux.RLock()
+	process, ok := manager.processes[name]
+	manager.mux.RUnlock()
+	if !ok {
+		return fmt.Errorf("process %s is not registered", name)
+	}
+	if _, ok := process.process.(*reusable); !ok {
+		return fmt.Errorf("process %s can not be restarted", name)
+	}
+
+	process.mux.Lock()
+	defer process.mux.Unlock()
+	if !manager.IsStarted() {
+		return fmt.Errorf("can not restart processes unless started")
+	}
+	manager.plog.Infof("[process:%s]: restarting", name)
+	atomic.StoreInt32(&process.restarting, 1)
+	switch atomic.LoadInt32(&process.state) {
+	case ProcessStateStopped, ProcessStateAborted:
+	default:
+		if err := process.Stop(); err != nil {
+			atomic.StoreInt32(&process.restarting, 0)
+			return fmt.Errorf("failed to stop process %s; %w", name, err)
+		}
+	}
+	<-process.control
+	atomic.StoreInt32(&process.restarting, 0)
+	if !manager.IsStarted() {
+		atomic.StoreInt32(&process.halted, 1)
+		return fmt.Errorf("manager stopped while restarting process %s", name)
+	}
+	atomic.StoreInt32(&process.state, ProcessStateStarted)
+	process.pend()
+	go manager.launch(name, process)
+	manager.plog.Infof("[process:%s]: restarted", name)
+	return nil
+}
+
 // Stop will signal the ProcessManager to stop.
 func (manager *Manager) Stop() {
 	if atomic.CompareAndSwapUint32(&manager.started, 1, 0) {
@@ -152,6 +390,61 @@ func (manager *Manager) Destroy() map[string]int32 {
 	return out
 }
 
+// Pause suspends the named process, which must implement the Pauser interface.
+func (manager *Manager) Pause(name string) error {
+	pauser, err := manager.pauser(name)
+	if err != nil {
+		return err
+	}
+	if err := pauser.Pause(); err != nil {
+		return err
+	}
+	manager.plog.Infof("[process:%s]: paused", name)
+	return nil
+}
+
+// Resume resumes the named process, which must implement the Pauser interface.
+func (manager *Manager) Resume(name string) error {
+	pauser, err := manager.pauser(name)
+	if err != nil {
+		return err
+	}
+	if err := pauser.Resume(); err != nil {
+		return err
+	}
+	manager.plog.Infof("[process:%s]: resumed", name)
+	return nil
+}
+
+func (manager *Manager) pauser(name string) (Pauser, error) {
+	manager.mux.RLock()
+	defer manager.mux.RUnlock()
+
+	process, ok := manager.processes[name]
+	if !ok {
+		return nil, fmt.Errorf("process %s is not registered", name)
+	}
+	pauser, ok := process.target().(Pauser)
+	if !ok {
+		return nil, fmt.Errorf("process %s can not be paused", name)
+	}
+	return pauser, nil
+}
+
+// Metrics returns the metrics of every process which implements the MetricsReporter interface, indexed by process name.
+func (manager *Manager) Metrics() map[string]map[string]float64 {
+	manager.mux.RLock()
+	defer manager.mux.RUnlock()
+
+	out := map[string]map[string]float64{}
+	for name, process := range manager.processes {
+		if reporter, ok := process.target().(MetricsReporter); ok {
+			out[name] = reporter.Metrics()
+		}
+	}
+	return out
+}
+
 // StatusCheck returns a tupple where the first value is a bool indicating if all processes are OK, second value is a map for de individual status of each process.
 func (manager *Manager) StatusCheck() (bool, map[string]int32) {
 	statuses := map[string]int32{}
@@ -161,8 +454,8 @@ func (manager *Manager) StatusCheck() (bool, map[string]int32) {
 	defer manager.mux.RUnlock()
 
 	for n, p := range manager.processes {
-		statuses[n] = atomic.LoadInt32(&p.state)
-		if atomic.LoadInt32(&p.state) == ProcessStateAborted {
+		statuses[n] = p.State()
+		if statuses[n] == ProcessStateAborted || statuses[n] == ProcessStateStuck {
 			status = false
 		}
 	}
@@ -1,9 +1,14 @@
 package procman
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func init() {
@@ -51,6 +56,57 @@ func (bss *SampleBadService) Stop() error {
 	return nil
 }
 
+type SampleDrainer struct {
+	stop    chan struct{}
+	drained chan struct{}
+	slow    bool
+	events  []string
+	mux     sync.Mutex
+}
+
+func NewSampleDrainer(slow bool) *SampleDrainer {
+	return &SampleDrainer{stop: make(chan struct{}), drained: make(chan struct{}), slow: slow}
+}
+
+func (sd *SampleDrainer) Start() error {
+	<-sd.stop
+	return nil
+}
+
+func (sd *SampleDrainer) Stop() error {
+	sd.event("stop")
+	close(sd.stop)
+	return nil
+}
+
+func (sd *SampleDrainer) Drain() error {
+	sd.event("drain")
+	go func() {
+		if sd.slow {
+			<-WaitAMillisecondTimes(500)
+		}
+		sd.event("drained")
+		close(sd.drained)
+	}()
+	return nil
+}
+
+func (sd *SampleDrainer) Drained() <-chan struct{} {
+	return sd.drained
+}
+
+func (sd *SampleDrainer) event(name string) {
+	sd.mux.Lock()
+	defer sd.mux.Unlock()
+	sd.events = append(sd.events, name)
+}
+
+func (sd *SampleDrainer) Events() []string {
+	sd.mux.Lock()
+	defer sd.mux.Unlock()
+	return append([]string{}, sd.events...)
+}
+
 func WaitABlinkOfAnEye() <-chan time.Time {
 	return time.After(40 * time.Millisecond)
 }
@@ -202,3 +258,234 @@ func TestProcessManagerStopsAfterOneProcessFailsInMany(t *testing.T) {
 		}
 	}
 }
+
+func TestProcessManagerPauseResume(t *testing.T) {
+	pman := NewManager()
+	pman.AddProcess("periodical", NewPeriodicalJob(10*time.Millisecond, func(ctx context.Context) error { return nil }))
+	pman.AddProcess("sample", &SampleService{})
+	pman.AddProcess("worker", NewWorker(func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}))
+
+	terminated := make(chan bool)
+	defer close(terminated)
+
+	go func() {
+		pman.Start()
+		terminated <- true
+	}()
+
+	<-WaitABlinkOfAnEye()
+
+	if err := pman.Pause("sample"); err == nil {
+		t.Error("expected error when pausing a process which can not be paused")
+	}
+	if err := pman.Pause("worker"); err == nil {
+		t.Error("expected error when pausing a worker")
+	}
+	if _, scs := pman.StatusCheck(); scs["worker"] != ProcessStateStarted {
+		t.Errorf("expected worker to be started but got %s", processStateString(scs["worker"]))
+	}
+	if err := pman.Pause("unknown"); err == nil {
+		t.Error("expected error when pausing an unknown process")
+	}
+	if err := pman.Pause("periodical"); err != nil {
+		t.Errorf("unexpected error pausing process: %+v", err)
+	}
+	if sc, scs := pman.StatusCheck(); !sc || scs["periodical"] != ProcessStatePaused {
+		t.Errorf("expected periodical to be paused but got %s", processStateString(scs["periodical"]))
+	}
+	if err := pman.Resume("periodical"); err != nil {
+		t.Errorf("unexpected error resuming process: %+v", err)
+	}
+	if _, scs := pman.StatusCheck(); scs["periodical"] != ProcessStateStarted {
+		t.Errorf("expected periodical to be started but got %s", processStateString(scs["periodical"]))
+	}
+
+	pman.Stop()
+
+	select {
+	case <-WaitAMillisecondTimes(500):
+		t.Fail()
+	case <-terminated:
+		t.Log("OK")
+	}
+}
+
+func TestProcessManagerRestart(t *testing.T) {
+	var builds int32
+	pman := NewManager()
+	pman.AddProcessFactory("worker", func() Process {
+		atomic.AddInt32(&builds, 1)
+		return NewWorker(func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		})
+	})
+	pman.AddProcessFactory("canceled", func() Process {
+		return NewWorker(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	})
+	pman.AddProcess("sample", &SampleService{})
+
+	if err := pman.Restart("worker"); err == nil {
+		t.Error("expected error when restarting a process before start")
+	}
+
+	terminated := make(chan bool)
+	defer close(terminated)
+
+	go func() {
+		pman.Start()
+		terminated <- true
+	}()
+
+	<-WaitABlinkOfAnEye()
+
+	if err := pman.Restart("sample"); err == nil {
+		t.Error("expected error when restarting a process which is not reusable")
+	}
+	for i := 0; i < 2; i++ {
+		if err := pman.Restart("worker"); err != nil {
+			t.Errorf("unexpected error restarting process: %+v", err)
+		}
+		<-WaitABlinkOfAnEye()
+	}
+	if n := atomic.LoadInt32(&builds); n != 3 {
+		t.Errorf("expected process to be built 3 times but got %d", n)
+	}
+	if _, scs := pman.StatusCheck(); scs["worker"] != ProcessStateStarted {
+		t.Errorf("expected worker to be started but got %s", processStateString(scs["worker"]))
+	}
+	// the error a process returns once stopped for a restart does not stop the manager
+	if err := pman.Restart("canceled"); err != nil {
+		t.Errorf("unexpected error restarting process: %+v", err)
+	}
+	<-WaitABlinkOfAnEye()
+	if !pman.IsStarted() {
+		t.Error("expected manager to keep running after restarting a process")
+	}
+	if _, scs := pman.StatusCheck(); scs["canceled"] != ProcessStateStarted {
+		t.Errorf("expected process to be started but got %s", processStateString(scs["canceled"]))
+	}
+
+	pman.Stop()
+
+	select {
+	case <-WaitAMillisecondTimes(500):
+		t.Fail()
+	case <-terminated:
+		t.Log("OK")
+	}
+}
+
+func TestProcessManagerStopWhileRestarting(t *testing.T) {
+	var builds int32
+	pman := NewManager()
+	pman.AddProcessFactory("slow", func() Process {
+		atomic.AddInt32(&builds, 1)
+		return NewWorker(func(ctx context.Context) error {
+			<-ctx.Done()
+			changeGear()
+			return nil
+		})
+	})
+
+	terminated := make(chan struct{})
+	go func() {
+		pman.Start()
+		close(terminated)
+	}()
+	<-WaitABlinkOfAnEye()
+
+	restarted := make(chan error, 1)
+	go func() {
+		restarted <- pman.Restart("slow")
+	}()
+	flapWings()
+	pman.Stop()
+
+	if err := <-restarted; err == nil {
+		t.Error("expected error when the manager stops during a restart")
+	}
+	if err := waitFor("manager", terminated, time.Second); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&builds); n != 1 {
+		t.Errorf("expected process to be built once but got %d", n)
+	}
+}
+
+func TestProcessManagerDrain(t *testing.T) {
+	t.Run("drain-then-stop", func(t *testing.T) {
+		drainer := NewSampleDrainer(false)
+		pman := NewManager()
+		pman.AddProcess("drainer", drainer)
+		pman.AddProcess("sample", &SampleService{})
+
+		terminated := make(chan struct{})
+		go func() {
+			pman.Start()
+			close(terminated)
+		}()
+		<-WaitABlinkOfAnEye()
+
+		pman.Stop()
+		assert.NoError(t, waitFor("manager", terminated, time.Second))
+		assert.Equal(t, []string{"drain", "drained", "stop"}, drainer.Events())
+	})
+
+	t.Run("queue-worker", func(t *testing.T) {
+		var in = make(chan int, 10)
+		for i := 0; i < 10; i++ {
+			in <- i
+		}
+		var started = make(chan struct{}, 10)
+		var canceled, unprocessed int32
+		worker := NewQueueWorker(in, func(ctx context.Context, item int) error {
+			started <- struct{}{}
+			changeGear()
+			if ctx.Err() != nil {
+				atomic.AddInt32(&canceled, 1)
+			}
+			return nil
+		}, QueueWorkerOptions[int]{Concurrency: 2, OnUnprocessed: func(int) { atomic.AddInt32(&unprocessed, 1) }})
+		pman := NewManager()
+		pman.AddProcess("queue", worker)
+
+		terminated := make(chan struct{})
+		go func() {
+			pman.Start()
+			close(terminated)
+		}()
+		<-started
+		<-started
+
+		// the in-flight items finish before the worker is stopped, which would cancel them
+		pman.Stop()
+		assert.NoError(t, waitFor("manager", terminated, time.Second))
+		assert.Len(t, started, 0)
+		assert.Equal(t, int32(0), atomic.LoadInt32(&canceled))
+		assert.Equal(t, int32(8), atomic.LoadInt32(&unprocessed))
+	})
+
+	t.Run("drain-timeout", func(t *testing.T) {
+		drainer := NewSampleDrainer(true)
+		pman := NewCustomManager(Parameters{DrainTimeout: 50 * time.Millisecond})
+		pman.AddProcess("drainer", drainer)
+
+		terminated := make(chan struct{})
+		go func() {
+			pman.Start()
+			close(terminated)
+		}()
+		<-WaitABlinkOfAnEye()
+
+		pman.Stop()
+		assert.NoError(t, waitFor("manager", terminated, 400*time.Millisecond))
+		assert.Equal(t, []string{"drain", "stop"}, drainer.Events())
+	})
+}
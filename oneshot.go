@@ -0,0 +1,188 @@
+package procman
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// PastPolicy defines what a one-shot job does when its scheduled time has already passed when it is started.
+type PastPolicy int
+
+const (
+	// PastRun runs the job right away.
+	PastRun PastPolicy = iota
+	// PastSkip does not run the job, Start returns without error.
+	PastSkip
+	// PastFail does not run the job, Start returns an error.
+	PastFail
+)
+
+// OneShotState is the state of a one-shot job.
+type OneShotState int32
+
+const (
+	// OneShotPending means the job is waiting for its scheduled time, or for being started.
+	OneShotPending OneShotState = iota
+	// OneShotFired means the job was executed, or is still running.
+	OneShotFired
+	// OneShotCanceled means the job was canceled before being executed.
+	OneShotCanceled
+	// OneShotSkipped means the job was not executed since its scheduled time had already passed when started.
+	OneShotSkipped
+)
+
+func (state OneShotState) String() string {
+	switch state {
+	case OneShotPending:
+		return "pending"
+	case OneShotFired:
+		return "fired"
+	case OneShotCanceled:
+		return "canceled"
+	case OneShotSkipped:
+		return "skipped"
+	}
+	return "UNKNOWN"
+}
+
+// OneShotOptions for tuning one-shot jobs.
+type OneShotOptions struct {
+	// Past defines what to do when the scheduled time has already passed when the job is started. Defaults to PastRun.
+	Past PastPolicy
+	// ShutdownTimeout sets the timeout to wait for Start() to finish after Stop() is called. Defaults to 60 seconds.
+	ShutdownTimeout time.Duration
+	// Clock used for scheduling the job. Defaults to the manager's clock or the SystemClock.
+	Clock Clock
+}
+
+func (opts *OneShotOptions) merge(new OneShotOptions) {
+	if new.Past != PastRun {
+		opts.Past = new.Past
+	}
+	if new.ShutdownTimeout > 0 {
+		opts.ShutdownTimeout = new.ShutdownTimeout
+	}
+	if new.Clock != nil {
+		opts.Clock = new.Clock
+	}
+}
+
+// OneShotJob is a Process which runs a job function once, at a scheduled time, and then returns.
+type OneShotJob interface {
+	Process
+	// Cancel prevents the job from being executed, making Start return without error. It fails if the job was already
+	// executed or skipped.
+	Cancel() error
+	// State of the job.
+	State() OneShotState
+	// Scheduled returns the time the job is scheduled for, which is only known once started for jobs scheduled after a delay.
+	Scheduled() time.Time
+}
+
+type oneShot struct {
+	runner *periodical
+	at     time.Time
+	delay  time.Duration
+	opts   OneShotOptions
+	state  int32
+	due    atomic.Value
+}
+
+// NewOneShotJob creates a one-shot job which runs job once at the given time, which is handy for scheduled tasks such as
+// a migration at 03:00. The context given to the job is canceled when the process is stopped. The process can be added
+// to a manager long before the scheduled time and returns once the job has run.
+func NewOneShotJob(at time.Time, job func(ctx context.Context) error, opts ...OneShotOptions) OneShotJob {
+	return newOneShot(at, 0, job, opts...)
+}
+
+// NewDelayedJob creates a one-shot job which runs job once the given delay has elapsed since the process was started,
+// which for processes added to a manager is when the manager starts. Otherwise it behaves just like NewOneShotJob.
+func NewDelayedJob(delay time.Duration, job func(ctx context.Context) error, opts ...OneShotOptions) OneShotJob {
+	return newOneShot(time.Time{}, delay, job, opts...)
+}
+
+func newOneShot(at time.Time, delay time.Duration, job func(ctx context.Context) error, opts ...OneShotOptions) *oneShot {
+	j := &oneShot{
+		at:    at,
+		delay: delay,
+	}
+	for _, opt := range opts {
+		j.opts.merge(opt)
+	}
+	j.runner = newPeriodical(0, false, func(ctx context.Context) (time.Duration, error) {
+		if !atomic.CompareAndSwapInt32(&j.state, int32(OneShotPending), int32(OneShotFired)) {
+			// canceled while due
+			return 0, nil
+		}
+		return 0, job(ctx)
+	}, PeriodicalOptions{
+		Once:            true,
+		ShutdownTimeout: j.opts.ShutdownTimeout,
+		Clock:           j.opts.Clock,
+	})
+	return j
+}
+
+// Start waits for the scheduled time and runs the job, returning its error.
+func (j *oneShot) Start() error {
+	if j.State() == OneShotCanceled {
+		return nil
+	}
+	var now = j.runner.opts.Clock.Now()
+	var at = j.at
+	if at.IsZero() {
+		at = now.Add(j.delay)
+	}
+	j.due.Store(at)
+	if at.Before(now) {
+		switch j.opts.Past {
+		case PastSkip:
+			if atomic.CompareAndSwapInt32(&j.state, int32(OneShotPending), int32(OneShotSkipped)) {
+				j.runner.opts.Dbgf("one-shot job scheduled in the past, skipping")
+			}
+			return nil
+		case PastFail:
+			return fmt.Errorf("one-shot job was scheduled for %s which has already passed", at.Format(time.RFC3339))
+		}
+	}
+	j.runner.startAt = at
+	err := j.runner.Start()
+	if err != nil && j.State() == OneShotCanceled {
+		// canceled while starting
+		return nil
+	}
+	return err
+}
+
+func (j *oneShot) Stop() error {
+	err := j.runner.Stop()
+	if err != nil && j.State() == OneShotCanceled {
+		// already stopped when canceled
+		return nil
+	}
+	return err
+}
+
+func (j *oneShot) Cancel() error {
+	if !atomic.CompareAndSwapInt32(&j.state, int32(OneShotPending), int32(OneShotCanceled)) {
+		return fmt.Errorf("error canceling one-shot job [state:%s]", j.State())
+	}
+	return j.runner.Stop()
+}
+
+func (j *oneShot) State() OneShotState {
+	return OneShotState(atomic.LoadInt32(&j.state))
+}
+
+func (j *oneShot) Scheduled() time.Time {
+	if at, ok := j.due.Load().(time.Time); ok {
+		return at
+	}
+	return j.at
+}
+
+func (j *oneShot) manage(env environment) {
+	j.runner.manage(env)
+}
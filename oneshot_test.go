@@ -0,0 +1,147 @@
+package procman
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOneShotJob(t *testing.T) {
+	var epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	// start runs j in its own go routine and returns a channel with the error it returns.
+	var start = func(j Process) chan error {
+		var errs = make(chan error, 1)
+		go func() {
+			errs <- j.Start()
+		}()
+		return errs
+	}
+
+	t.Run("at", func(t *testing.T) {
+		var clock = NewFakeClock(epoch)
+		var runs = make(chan time.Time, 1)
+		var j = NewOneShotJob(epoch.Add(3*time.Hour), func(ctx context.Context) error {
+			runs <- clock.Now()
+			return nil
+		}, OneShotOptions{Clock: clock})
+		assert.Equal(t, OneShotPending, j.State())
+		var errs = start(j)
+		clock.BlockUntil(1)
+		clock.Advance(2 * time.Hour)
+		assert.Len(t, runs, 0)
+		assert.Equal(t, OneShotPending, j.State())
+		clock.BlockUntil(1)
+		clock.Advance(time.Hour)
+		assert.Equal(t, epoch.Add(3*time.Hour), <-runs)
+		assert.Nil(t, <-errs)
+		assert.Equal(t, OneShotFired, j.State())
+		assert.Nil(t, j.Stop())
+	})
+	t.Run("delay", func(t *testing.T) {
+		var clock = NewFakeClock(epoch)
+		var runs = make(chan time.Time, 1)
+		var j = NewDelayedJob(time.Minute, func(ctx context.Context) error {
+			runs <- clock.Now()
+			return nil
+		}, OneShotOptions{Clock: clock})
+		clock.Advance(time.Hour)
+		var errs = start(j)
+		clock.BlockUntil(1)
+		assert.Equal(t, epoch.Add(time.Hour+time.Minute), j.Scheduled())
+		clock.Advance(time.Minute)
+		assert.Equal(t, epoch.Add(time.Hour+time.Minute), <-runs)
+		assert.Nil(t, <-errs)
+	})
+	t.Run("error", func(t *testing.T) {
+		var j = NewDelayedJob(0, func(ctx context.Context) error {
+			return errDefault
+		})
+		assert.ErrorIs(t, j.Start(), errDefault)
+		assert.Equal(t, OneShotFired, j.State())
+	})
+	t.Run("cancel", func(t *testing.T) {
+		var clock = NewFakeClock(epoch)
+		var j = NewOneShotJob(epoch.Add(time.Hour), func(ctx context.Context) error {
+			t.Error("canceled job was executed")
+			return nil
+		}, OneShotOptions{Clock: clock})
+		var errs = start(j)
+		clock.BlockUntil(1)
+		assert.Nil(t, j.Cancel())
+		assert.Nil(t, <-errs)
+		assert.Equal(t, OneShotCanceled, j.State())
+		assert.Error(t, j.Cancel())
+		assert.Nil(t, j.Stop())
+	})
+	t.Run("cancel-before-start", func(t *testing.T) {
+		var j = NewDelayedJob(0, func(ctx context.Context) error {
+			t.Error("canceled job was executed")
+			return nil
+		})
+		assert.Nil(t, j.Cancel())
+		assert.Nil(t, j.Start())
+		assert.Equal(t, OneShotCanceled, j.State())
+	})
+	t.Run("stop", func(t *testing.T) {
+		var clock = NewFakeClock(epoch)
+		var j = NewOneShotJob(epoch.Add(time.Hour), func(ctx context.Context) error {
+			return nil
+		}, OneShotOptions{Clock: clock})
+		var errs = start(j)
+		clock.BlockUntil(1)
+		assert.Nil(t, j.Stop())
+		assert.Nil(t, <-errs)
+		assert.Equal(t, OneShotPending, j.State())
+	})
+	t.Run("past", func(t *testing.T) {
+		var clock = NewFakeClock(epoch)
+		var ran bool
+		var job = func(ctx context.Context) error {
+			ran = true
+			return nil
+		}
+
+		var j = NewOneShotJob(epoch.Add(-time.Hour), job, OneShotOptions{Clock: clock})
+		assert.Nil(t, j.Start())
+		assert.True(t, ran)
+		assert.Equal(t, OneShotFired, j.State())
+
+		ran = false
+		j = NewOneShotJob(epoch.Add(-time.Hour), job, OneShotOptions{Clock: clock, Past: PastSkip})
+		assert.Nil(t, j.Start())
+		assert.False(t, ran)
+		assert.Equal(t, OneShotSkipped, j.State())
+		assert.Error(t, j.Cancel())
+
+		j = NewOneShotJob(epoch.Add(-time.Hour), job, OneShotOptions{Clock: clock, Past: PastFail})
+		assert.ErrorContains(t, j.Start(), "has already passed")
+		assert.False(t, ran)
+		assert.Equal(t, OneShotPending, j.State())
+	})
+	t.Run("manager", func(t *testing.T) {
+		var clock = NewFakeClock(epoch)
+		var runs = make(chan time.Time, 1)
+		pman := NewCustomManager(Parameters{Clock: clock})
+		// the delay is measured from the manager start, not from when the job is added
+		pman.AddProcess("migration", NewDelayedJob(time.Minute, func(ctx context.Context) error {
+			runs <- clock.Now()
+			return nil
+		}))
+		clock.Advance(time.Hour)
+
+		terminated := make(chan struct{})
+		go func() {
+			pman.Start()
+			close(terminated)
+		}()
+		changeGear()
+		clock.Advance(59 * time.Second)
+		assert.Len(t, runs, 0)
+		clock.Advance(time.Second)
+		assert.Equal(t, epoch.Add(time.Hour+time.Minute), <-runs)
+		pman.Stop()
+		assert.NoError(t, waitFor("manager", terminated, time.Second))
+	})
+}
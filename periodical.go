@@ -2,7 +2,9 @@ package procman
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -15,10 +17,47 @@ type PeriodicalOptions struct {
 	Once bool
 	// ShutdownTimeout defines the max time to wait for a job to finish after Stop() is called. Defaults to 60 seconds. Must be at least 1 second.
 	ShutdownTimeout time.Duration
+	// MissedRuns defines what to do with executions which became due while the job was still running or idleing.
+	// Defaults to MissedRunOnce. Has no effect on adaptive jobs.
+	MissedRuns MissedRunPolicy
+	// MaxOverlap is the max number of concurrent executions when MissedRuns is MissedRunOverlap. Defaults to 2.
+	MaxOverlap int
+	// Windows in which the job is allowed to run. Executions due outside of them are deferred to the start of the next one.
+	// Defaults to none, meaning the job may run at any time.
+	Windows []TimeWindow
+	// Blackouts in which the job is not allowed to run. Executions due during one are deferred to its end.
+	Blackouts []Blackout
+	// CancelOutsideWindow, if true, cancels the context of a running execution, with ErrOutsideWindow as cause, when its
+	// window closes or a blackout starts. Errors returned by executions canceled this way do not stop the job.
+	CancelOutsideWindow bool
+	// RateLimit limits how often the job is executed, on top of its period, which is useful for jobs with a period of 0.
+	// Defaults to no limit.
+	RateLimit RateLimit
+	// HistorySize is the number of executions, or skipped executions, kept in the run history. Defaults to 10.
+	HistorySize int
+	// Clock used for scheduling executions and timeouts. Defaults to the manager's clock, if the job is added to one, or
+	// the SystemClock.
+	Clock Clock
 	// Dbgf function is called for debugging purposes when certain periodical job controller's events happen.
 	Dbgf func(fmt string, args ...interface{})
 }
 
+// MissedRunPolicy defines how a periodical job handles executions which were due while it was busy.
+type MissedRunPolicy int
+
+const (
+	// MissedRunOnce runs a single execution as soon as possible for all the missed ones, the others are skipped.
+	MissedRunOnce MissedRunPolicy = iota
+	// MissedRunSkip skips all missed executions and waits for the next one.
+	MissedRunSkip
+	// MissedRunCatchUp runs every missed execution, one after the other, until the job is back on schedule.
+	MissedRunCatchUp
+	// MissedRunOverlap runs every execution when it is due, even if previous ones are still running, as long as no more
+	// than MaxOverlap are running at the same time; otherwise the execution is skipped, or delayed until one finishes for
+	// jobs with a period of 0. Idle time has no effect.
+	MissedRunOverlap
+)
+
 func (opts *PeriodicalOptions) merge(new PeriodicalOptions) {
 	if new.Idle > 0 {
 		opts.Idle = new.Idle
@@ -29,6 +68,30 @@ func (opts *PeriodicalOptions) merge(new PeriodicalOptions) {
 	if new.ShutdownTimeout > 0 {
 		opts.ShutdownTimeout = new.ShutdownTimeout
 	}
+	if new.MissedRuns != MissedRunOnce {
+		opts.MissedRuns = new.MissedRuns
+	}
+	if new.MaxOverlap > 0 {
+		opts.MaxOverlap = new.MaxOverlap
+	}
+	if len(new.Windows) > 0 {
+		opts.Windows = new.Windows
+	}
+	if len(new.Blackouts) > 0 {
+		opts.Blackouts = new.Blackouts
+	}
+	if new.CancelOutsideWindow {
+		opts.CancelOutsideWindow = new.CancelOutsideWindow
+	}
+	if new.RateLimit != (RateLimit{}) {
+		opts.RateLimit = new.RateLimit
+	}
+	if new.HistorySize > 0 {
+		opts.HistorySize = new.HistorySize
+	}
+	if new.Clock != nil {
+		opts.Clock = new.Clock
+	}
 	if new.Dbgf != nil {
 		opts.Dbgf = new.Dbgf
 	}
@@ -38,20 +101,90 @@ func (opts *PeriodicalOptions) sanitize() {
 	if opts.ShutdownTimeout < time.Second {
 		opts.ShutdownTimeout = 60 * time.Second
 	}
+	if opts.MaxOverlap < 1 {
+		opts.MaxOverlap = 2
+	}
+	if opts.HistorySize < 1 {
+		opts.HistorySize = 10
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock()
+	}
 	if opts.Dbgf == nil {
 		opts.Dbgf = func(fmt string, args ...interface{}) {}
 	}
 }
 
+// ErrOutsideWindow is the cause of the cancelation of an execution which was still running when its window closed.
+var ErrOutsideWindow = errors.New("execution window closed")
+
+// PeriodicalStats holds the execution counters and recent run history of a periodical job.
+type PeriodicalStats struct {
+	// Runs is the number of executions started.
+	Runs uint64
+	// Failures is the number of executions which returned an error.
+	Failures uint64
+	// Skipped is the number of executions skipped due to the missed runs policy or because the job was paused.
+	Skipped uint64
+	// Running is the number of executions currently running.
+	Running int
+	// History of the most recent executions, oldest first.
+	History []RunRecord
+}
+
+// RunRecord describes an execution of a periodical job or a set of skipped executions.
+type RunRecord struct {
+	// Scheduled is the time the execution was due.
+	Scheduled time.Time
+	// Started is the time the execution started; zero for skipped executions.
+	Started time.Time
+	// Duration of the execution.
+	Duration time.Duration
+	// Skipped is the number of executions skipped from Scheduled on, in which case nothing was executed.
+	Skipped int
+	// Err returned by the job.
+	Err error
+}
+
+// PeriodicalJob is a Process which runs a job function periodically and which can be paused, resumed, triggered and
+// rescheduled while running.
+type PeriodicalJob interface {
+	Process
+	Pauser
+	// SetPeriod changes the period between executions. The next execution is rescheduled from the previous one.
+	SetPeriod(period time.Duration) error
+	// SetIdle changes the idle time after each execution.
+	SetIdle(idle time.Duration) error
+	// Trigger requests an execution as soon as possible, skipping any period or idle time still to elapse.
+	// If the job is running, it is executed once more right after it finishes. The period restarts from the triggered execution.
+	Trigger() error
+	// Stats returns a snapshot of the job execution counters and run history.
+	Stats() PeriodicalStats
+}
+
 type periodical struct {
-	state  int32
-	job    func(ctx context.Context) error
-	done   chan struct{}
-	stop   chan struct{}
-	ctx    context.Context
-	cancel context.CancelFunc
-	period time.Duration
-	opts   PeriodicalOptions
+	state    int32
+	paused   int32
+	period   int64
+	idle     int64
+	adaptive bool
+	job      func(ctx context.Context) (time.Duration, error)
+	done     chan struct{}
+	stop     chan struct{}
+	resumed  chan struct{}
+	reset    chan struct{}
+	trigger  chan struct{}
+	finished chan struct{}
+	failed   chan error
+	ctx      context.Context
+	cancel   context.CancelFunc
+	opts     PeriodicalOptions
+	ownClock bool
+	lookup   func(name string) *rateLimiter
+	startAt  time.Time
+	tt       timetable
+	stats    PeriodicalStats
+	mux      sync.Mutex
 }
 
 // NewPeriodicalJob creates a periodical runner of a "job" function which will be executed one at a time and no more than once each period.
@@ -59,13 +192,35 @@ type periodical struct {
 // Job is allowed to shutdown without error, on error the periodical controller stops immediately.
 // Job will be executed after each period elapses unless it is already running (runs only one at a time).
 // Period can be 0 for just setting up continous execution.
-func NewPeriodicalJob(period time.Duration, job func(ctx context.Context) error, options ...PeriodicalOptions) Process {
+// While paused, the job is not executed; an ongoing execution is allowed to finish and executions due during the pause are skipped.
+// Jobs which run Once can not be paused.
+func NewPeriodicalJob(period time.Duration, job func(ctx context.Context) error, options ...PeriodicalOptions) PeriodicalJob {
+	return newPeriodical(period, false, func(ctx context.Context) (time.Duration, error) {
+		return 0, job(ctx)
+	}, options...)
+}
+
+// NewAdaptiveJob creates a periodical runner of a "job" function which decides by itself when it should run next.
+// The duration returned by the job is the delay until its next execution, measured from the moment it returns; a delay of
+// 0 runs it again immediately. Other than that, it behaves just like a job created with NewPeriodicalJob, which means
+// idle time, Stop, Trigger and Pause all apply. SetPeriod only changes the delay until the job returns a new one.
+func NewAdaptiveJob(job func(ctx context.Context) (time.Duration, error), options ...PeriodicalOptions) PeriodicalJob {
+	return newPeriodical(0, true, job, options...)
+}
+
+func newPeriodical(period time.Duration, adaptive bool, job func(ctx context.Context) (time.Duration, error), options ...PeriodicalOptions) *periodical {
 	c := &periodical{
-		state:  ProcessStateReady,
-		done:   make(chan struct{}),
-		stop:   make(chan struct{}),
-		job:    job,
-		period: period,
+		state:    ProcessStateReady,
+		done:     make(chan struct{}),
+		stop:     make(chan struct{}),
+		resumed:  make(chan struct{}),
+		reset:    make(chan struct{}, 1),
+		trigger:  make(chan struct{}, 1),
+		finished: make(chan struct{}, 1),
+		failed:   make(chan error, 1),
+		job:      job,
+		period:   int64(period),
+		adaptive: adaptive,
 	}
 
 	c.ctx, c.cancel = context.WithCancel(context.Background())
@@ -73,28 +228,93 @@ func NewPeriodicalJob(period time.Duration, job func(ctx context.Context) error,
 	for _, o := range options {
 		c.opts.merge(o)
 	}
+	c.ownClock = c.opts.Clock != nil
 	c.opts.sanitize()
+	c.idle = int64(c.opts.Idle)
+	c.tt = timetable{windows: c.opts.Windows, blackouts: c.opts.Blackouts}
 
 	return c
 }
 
+func (c *periodical) manage(env environment) {
+	if !c.ownClock {
+		c.opts.Clock = env.clock
+	}
+	c.lookup = env.limiter
+	if env.ctx != nil && atomic.LoadInt32(&c.state) == ProcessStateReady {
+		c.cancel()
+		c.ctx, c.cancel = context.WithCancel(env.ctx)
+	}
+}
+
 func (c *periodical) Start() (err error) {
 	if !atomic.CompareAndSwapInt32(&c.state, ProcessStateReady, ProcessStateStarted) {
 		return fmt.Errorf("error starting periodical job [state:%s]", processStateString(atomic.LoadInt32(&c.state)))
 	}
 	defer close(c.done)
 
-	var ticker *time.Ticker
-	if c.period > 0 {
-		ticker = time.NewTicker(c.period)
+	var overlaps sync.WaitGroup
+	defer overlaps.Wait()
+
+	limiter, err := c.limiter(c.opts.RateLimit)
+	if err != nil {
+		c.cancel()
+		return err
 	}
-	for {
+
+	var base, notBefore = c.opts.Clock.Now(), c.startAt
+	for immediate := true; ; immediate = false {
+		var ok bool
+		if base, ok, err = c.next(base, notBefore, immediate); err != nil {
+			c.cancel()
+			return err
+		} else if !ok {
+			c.opts.Dbgf("periodical job stopped")
+			return nil
+		}
 		if atomic.LoadInt32(&c.state) != ProcessStateStarted {
 			c.opts.Dbgf("new iteration but periodical job is already stopped")
 			return nil
 		}
+		if limiter != nil && limiter.wait(c.ctx) != nil {
+			c.opts.Dbgf("periodical job stopped while rate limited")
+			return nil
+		}
+		select {
+		case <-c.trigger:
+		default:
+		}
+		if c.opts.MissedRuns == MissedRunOverlap && !c.opts.Once {
+			if !c.begin(c.opts.MaxOverlap) {
+				if c.periodTime() == 0 {
+					// continuous jobs have no next execution to skip to, so they wait for a running one to finish
+					if err := c.awaitFinished(); err != nil {
+						c.cancel()
+						return err
+					}
+					continue
+				}
+				c.opts.Dbgf("periodical job is running too many times, skipping execution")
+				c.skip(base, 1)
+				continue
+			}
+			overlaps.Add(1)
+			go func(scheduled time.Time) {
+				defer overlaps.Done()
+				defer c.wake(c.finished)
+				if err := c.overlap(scheduled); err != nil {
+					select {
+					case c.failed <- err:
+					default:
+					}
+				}
+			}(base)
+			continue
+		}
+		c.begin(0)
 		c.opts.Dbgf("running periodical job")
-		if err := c.job(c.ctx); err != nil {
+		delay, err := c.run(base)
+		if err != nil {
 			return err
 		}
 		c.opts.Dbgf("periodical job finished")
@@ -105,32 +325,320 @@ func (c *periodical) Start() (err error) {
 		if c.opts.Once {
 			return nil
 		}
-		if c.opts.Idle > 0 {
-			c.opts.Dbgf("periodical job is idleing")
-			select {
-			case <-c.stop:
-				c.opts.Dbgf("periodical job stopped during idle period")
-				return nil
-			case <-time.After(c.opts.Idle):
-				c.opts.Dbgf("periodical job done idleing, back to work")
-			}
+		if c.adaptive {
+			atomic.StoreInt64(&c.period, int64(max(delay, 0)))
+			base = c.opts.Clock.Now()
+		}
+		notBefore = c.opts.Clock.Now().Add(c.idleTime())
+	}
+}
+
+// awaitFinished blocks until an overlapping execution finishes or the job is stopped, returning the error of an
+// overlapping execution which failed.
+func (c *periodical) awaitFinished() error {
+	select {
+	case <-c.finished:
+	case <-c.stop:
+	case err := <-c.failed:
+		return err
+	}
+	return nil
+}
+
+// limiter returns the rate limiter for the given limit, or nil if there is no limit.
+func (c *periodical) limiter(limit RateLimit) (*rateLimiter, error) {
+	if limit.Shared != "" {
+		var limiter *rateLimiter
+		if c.lookup != nil {
+			limiter = c.lookup(limit.Shared)
+		}
+		if limiter == nil {
+			return nil, fmt.Errorf("rate limiter %s is not registered", limit.Shared)
 		}
+		return limiter, nil
+	}
+	if limit.Rate <= 0 {
+		return nil, nil
+	}
+	return newRateLimiter(limit, c.opts.Clock), nil
+}
+
+// next blocks until the next execution is due and returns the time it was scheduled for, or false if the job was stopped
+// in the meantime. Executions are scheduled one period after base, unless immediate is set, and never before notBefore.
+// An error is returned if an overlapping execution failed.
+func (c *periodical) next(base, notBefore time.Time, immediate bool) (time.Time, bool, error) {
+	for {
 		select {
 		case <-c.stop:
-			c.opts.Dbgf("periodical job stopped")
-			return nil
+			return base, false, nil
 		default:
 		}
-		if c.period > 0 {
-			select {
-			case <-c.stop:
-				c.opts.Dbgf("periodical job stopped")
-				return nil
-			case <-ticker.C:
+
+		var now, period = c.opts.Clock.Now(), c.periodTime()
+		var due = base
+		if !immediate {
+			due = base.Add(period)
+			if period > 0 && !c.adaptive && due.Before(now) {
+				if missed := c.missed(due, now, period); missed > 0 {
+					c.skip(due, missed)
+					base = due.Add(time.Duration(missed-1) * period)
+					continue
+				}
+			}
+		}
+		var at = due
+		if notBefore.After(at) && c.opts.MissedRuns != MissedRunOverlap {
+			at = notBefore
+		}
+		var never bool
+		if !c.tt.empty() {
+			if allowed, ok := c.tt.next(at); !ok {
+				never = true
+			} else if allowed.After(at) {
+				due, at = allowed, allowed
+			}
+		}
+
+		var expired <-chan time.Time
+		var resumed <-chan struct{}
+		var paused = c.IsPaused()
+		if paused {
+			resumed = c.resumedChan()
+			if period > 0 {
+				expired = c.opts.Clock.After(due.Sub(now))
+			}
+		} else if never {
+			c.opts.Dbgf("periodical job has no execution window left")
+		} else if at.After(now) {
+			expired = c.opts.Clock.After(at.Sub(now))
+		} else {
+			return due, true, nil
+		}
+
+		select {
+		case <-c.stop:
+			return base, false, nil
+		case err := <-c.failed:
+			return base, false, err
+		case <-c.reset:
+			c.opts.Dbgf("periodical job rescheduled")
+		case <-resumed:
+			c.opts.Dbgf("periodical job resumed")
+		case <-c.trigger:
+			if c.IsPaused() {
+				break
+			}
+			if now := c.opts.Clock.Now(); c.tt.allows(now) {
+				c.opts.Dbgf("periodical job triggered")
+				return now, true, nil
+			}
+			c.opts.Dbgf("periodical job triggered outside of its execution windows, deferring")
+			base, immediate = c.opts.Clock.Now(), true
+		case <-expired:
+			if !c.IsPaused() {
 				c.opts.Dbgf("periodical job period expired")
+				return due, true, nil
 			}
+			c.opts.Dbgf("periodical job is paused, skipping execution")
+			c.skip(due, 1)
+			base, immediate = due, false
+		}
+	}
+}
+
+// missed returns the number of executions to skip, according to the missed runs policy, when the execution which was due
+// is already late.
+func (c *periodical) missed(due, now time.Time, period time.Duration) int {
+	var late = int(now.Sub(due) / period)
+	switch c.opts.MissedRuns {
+	case MissedRunCatchUp:
+		return 0
+	case MissedRunSkip:
+		return late + 1
+	default:
+		return late
+	}
+}
+
+// begin registers the start of an execution unless there are already limit executions running; 0 means no limit.
+func (c *periodical) begin(limit int) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if limit > 0 && c.stats.Running >= limit {
+		return false
+	}
+	c.stats.Runs++
+	c.stats.Running++
+	return true
+}
+
+func (c *periodical) run(scheduled time.Time) (time.Duration, error) {
+	var started = c.opts.Clock.Now()
+	var failure error
+	defer func() {
+		c.mux.Lock()
+		defer c.mux.Unlock()
+		c.stats.Running--
+		if failure != nil {
+			c.stats.Failures++
 		}
+		c.record(RunRecord{Scheduled: scheduled, Started: started, Duration: c.opts.Clock.Now().Sub(started), Err: failure})
+	}()
+	var ctx, cancel = c.runContext(started)
+	defer cancel(nil)
+	Heartbeat(ctx)
+	defer Heartbeat(ctx)
+	delay, failure := c.job(ctx)
+	if failure != nil && context.Cause(ctx) == ErrOutsideWindow {
+		c.opts.Dbgf("periodical job canceled outside of its execution window")
+		return delay, nil
+	}
+	return delay, failure
+}
+
+// runContext returns the context for an execution starting at started which, if CancelOutsideWindow is set, is canceled
+// when the execution window closes.
+func (c *periodical) runContext(started time.Time) (context.Context, context.CancelCauseFunc) {
+	var ctx, cancel = context.WithCancelCause(c.ctx)
+	if !c.opts.CancelOutsideWindow {
+		return ctx, cancel
+	}
+	if end, ok := c.tt.until(started); ok {
+		go func() {
+			select {
+			case <-ctx.Done():
+			case <-c.opts.Clock.After(end.Sub(started)):
+				cancel(ErrOutsideWindow)
+			}
+		}()
 	}
+	return ctx, cancel
+}
+
+// overlap runs an overlapping execution in its own go routine.
+func (c *periodical) overlap(scheduled time.Time) error {
+	c.opts.Dbgf("running overlapping periodical job")
+	return safely("periodical job panic", func() error {
+		_, err := c.run(scheduled)
+		return err
+	})
+}
+
+func (c *periodical) skip(scheduled time.Time, n int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.stats.Skipped += uint64(n)
+	c.record(RunRecord{Scheduled: scheduled, Skipped: n})
+}
+
+// record adds an entry to the run history; must be called with the lock held.
+func (c *periodical) record(record RunRecord) {
+	if len(c.stats.History) >= c.opts.HistorySize {
+		c.stats.History = append(c.stats.History[:0], c.stats.History[1:]...)
+	}
+	c.stats.History = append(c.stats.History, record)
+}
+
+func (c *periodical) Stats() PeriodicalStats {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	var stats = c.stats
+	stats.History = append([]RunRecord(nil), c.stats.History...)
+	return stats
+}
+
+// Metrics of the periodical job.
+func (c *periodical) Metrics() map[string]float64 {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return map[string]float64{
+		"runs":     float64(c.stats.Runs),
+		"failures": float64(c.stats.Failures),
+		"skipped":  float64(c.stats.Skipped),
+		"running":  float64(c.stats.Running),
+	}
+}
+
+func (c *periodical) periodTime() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.period))
+}
+
+func (c *periodical) idleTime() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.idle))
+}
+
+func (c *periodical) wake(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func (c *periodical) SetPeriod(period time.Duration) error {
+	if period < 0 {
+		return fmt.Errorf("periodical job period can not be negative")
+	}
+	atomic.StoreInt64(&c.period, int64(period))
+	c.wake(c.reset)
+	return nil
+}
+
+func (c *periodical) SetIdle(idle time.Duration) error {
+	if idle < 0 {
+		return fmt.Errorf("periodical job idle time can not be negative")
+	}
+	atomic.StoreInt64(&c.idle, int64(idle))
+	c.wake(c.reset)
+	return nil
+}
+
+func (c *periodical) Trigger() error {
+	switch state := atomic.LoadInt32(&c.state); state {
+	case ProcessStateReady, ProcessStateStarted:
+	default:
+		return fmt.Errorf("error triggering periodical job [state:%s]", processStateString(state))
+	}
+	c.wake(c.trigger)
+	return nil
+}
+
+func (c *periodical) resumedChan() <-chan struct{} {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.resumed
+}
+
+func (c *periodical) Pause() error {
+	if c.opts.Once {
+		return fmt.Errorf("periodical job runs only once and can not be paused")
+	}
+	switch state := atomic.LoadInt32(&c.state); state {
+	case ProcessStateReady, ProcessStateStarted:
+	default:
+		return fmt.Errorf("error pausing periodical job [state:%s]", processStateString(state))
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if !atomic.CompareAndSwapInt32(&c.paused, 0, 1) {
+		return fmt.Errorf("periodical job is already paused")
+	}
+	c.resumed = make(chan struct{})
+	c.opts.Dbgf("periodical job paused")
+	return nil
+}
+
+func (c *periodical) Resume() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if !atomic.CompareAndSwapInt32(&c.paused, 1, 0) {
+		return fmt.Errorf("periodical job is not paused")
+	}
+	close(c.resumed)
+	return nil
+}
+
+func (c *periodical) IsPaused() bool {
+	return atomic.LoadInt32(&c.paused) == 1
 }
 
 func (c *periodical) Stop() error {
@@ -152,7 +660,7 @@ func (c *periodical) Stop() error {
 	case <-c.done:
 		atomic.CompareAndSwapInt32(&c.state, ProcessStateStopping, ProcessStateStopped)
 		return nil
-	case <-time.After(c.opts.ShutdownTimeout):
+	case <-c.opts.Clock.After(c.opts.ShutdownTimeout):
 		atomic.CompareAndSwapInt32(&c.state, ProcessStateStopping, ProcessStateAborted)
 		return fmt.Errorf("process terminated after shutdown timeout exceeded")
 	}
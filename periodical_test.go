@@ -3,6 +3,7 @@ package procman
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -173,4 +174,333 @@ func TestPeriodical(t *testing.T) {
 		}()
 		assert.Nil(t, waitForSteps(steps, time.Second))
 	})
+	t.Run("pause-and-resume", func(t *testing.T) {
+		var runs int32
+		var c = NewPeriodicalJob(10*time.Millisecond, func(ctx context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		})
+		var steps = makeSteps(2)
+		go func() {
+			assert.Nil(t, c.Start())
+			close(steps[0])
+		}()
+		go func() {
+			changeGear()
+			assert.Nil(t, c.Pause())
+			assert.NotNil(t, c.Pause())
+			assert.True(t, c.IsPaused())
+			flapWings()
+			var paused = atomic.LoadInt32(&runs)
+			changeGear()
+			assert.Equal(t, paused, atomic.LoadInt32(&runs))
+			assert.Nil(t, c.Resume())
+			assert.NotNil(t, c.Resume())
+			changeGear()
+			assert.Greater(t, atomic.LoadInt32(&runs), paused)
+			assert.Nil(t, c.Stop())
+			close(steps[1])
+		}()
+		assert.Nil(t, waitForSteps(steps, time.Second))
+	})
+	t.Run("pause-continuous", func(t *testing.T) {
+		var runs int32
+		var c = NewPeriodicalJob(0, func(ctx context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			flapWings()
+			return nil
+		})
+		assert.Nil(t, c.Pause())
+		var steps = makeSteps(2)
+		go func() {
+			assert.Nil(t, c.Start())
+			close(steps[0])
+		}()
+		go func() {
+			changeGear()
+			assert.Equal(t, int32(0), atomic.LoadInt32(&runs))
+			assert.Nil(t, c.Resume())
+			changeGear()
+			assert.Greater(t, atomic.LoadInt32(&runs), int32(0))
+			assert.Nil(t, c.Stop())
+			close(steps[1])
+		}()
+		assert.Nil(t, waitForSteps(steps, time.Second))
+	})
+	t.Run("set-period", func(t *testing.T) {
+		var runs int32
+		var c = NewPeriodicalJob(time.Hour, func(ctx context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		})
+		var steps = makeSteps(2)
+		go func() {
+			assert.Nil(t, c.Start())
+			close(steps[0])
+		}()
+		go func() {
+			changeGear()
+			assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+			assert.NotNil(t, c.SetPeriod(-time.Second))
+			assert.Nil(t, c.SetPeriod(10*time.Millisecond))
+			changeGear()
+			assert.Greater(t, atomic.LoadInt32(&runs), int32(2))
+			assert.Nil(t, c.SetIdle(time.Hour))
+			changeGear()
+			var idle = atomic.LoadInt32(&runs)
+			changeGear()
+			assert.Equal(t, idle, atomic.LoadInt32(&runs))
+			assert.Nil(t, c.Stop())
+			close(steps[1])
+		}()
+		assert.Nil(t, waitForSteps(steps, time.Second))
+	})
+	t.Run("trigger", func(t *testing.T) {
+		var runs int32
+		var c = NewPeriodicalJob(time.Hour, func(ctx context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		})
+		var steps = makeSteps(2)
+		go func() {
+			assert.Nil(t, c.Start())
+			close(steps[0])
+		}()
+		go func() {
+			changeGear()
+			assert.Nil(t, c.Trigger())
+			changeGear()
+			assert.Equal(t, int32(2), atomic.LoadInt32(&runs))
+			assert.Nil(t, c.Stop())
+			assert.NotNil(t, c.Trigger())
+			close(steps[1])
+		}()
+		assert.Nil(t, waitForSteps(steps, time.Second))
+	})
+	t.Run("adaptive", func(t *testing.T) {
+		var runs int32
+		var c = NewAdaptiveJob(func(ctx context.Context) (time.Duration, error) {
+			if atomic.AddInt32(&runs, 1) < 3 {
+				return 0, nil
+			}
+			return time.Hour, nil
+		})
+		var steps = makeSteps(2)
+		go func() {
+			assert.Nil(t, c.Start())
+			close(steps[0])
+		}()
+		go func() {
+			changeGear()
+			assert.Equal(t, int32(3), atomic.LoadInt32(&runs))
+			assert.Nil(t, c.Trigger())
+			changeGear()
+			assert.Equal(t, int32(4), atomic.LoadInt32(&runs))
+			assert.Nil(t, c.Stop())
+			close(steps[1])
+		}()
+		assert.Nil(t, waitForSteps(steps, time.Second))
+	})
+}
+
+func TestPeriodicalMissedRuns(t *testing.T) {
+	var run = func(t *testing.T, policy MissedRunPolicy) PeriodicalStats {
+		var runs int32
+		var c = NewPeriodicalJob(10*time.Millisecond, func(ctx context.Context) error {
+			if atomic.AddInt32(&runs, 1) == 1 {
+				time.Sleep(55 * time.Millisecond)
+			}
+			return nil
+		}, PeriodicalOptions{MissedRuns: policy})
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, c.Start())
+			close(steps[0])
+		}()
+		<-time.After(60 * time.Millisecond)
+		var stats = c.Stats()
+		assert.Nil(t, c.Stop())
+		assert.Nil(t, waitForSteps(steps, time.Second))
+		return stats
+	}
+
+	t.Run("once", func(t *testing.T) {
+		var stats = run(t, MissedRunOnce)
+		assert.GreaterOrEqual(t, stats.Skipped, uint64(4))
+		assert.GreaterOrEqual(t, stats.History[1].Skipped, 4)
+		assert.Zero(t, stats.History[2].Skipped)
+	})
+	t.Run("skip", func(t *testing.T) {
+		var stats = run(t, MissedRunSkip)
+		assert.GreaterOrEqual(t, stats.Skipped, uint64(5))
+		assert.LessOrEqual(t, stats.Runs, uint64(2))
+	})
+	t.Run("catch-up", func(t *testing.T) {
+		var stats = run(t, MissedRunCatchUp)
+		assert.Zero(t, stats.Skipped)
+		assert.GreaterOrEqual(t, stats.Runs, uint64(6))
+	})
+	t.Run("overlap", func(t *testing.T) {
+		var c = NewPeriodicalJob(10*time.Millisecond, func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}, PeriodicalOptions{MissedRuns: MissedRunOverlap, MaxOverlap: 2})
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, c.Start())
+			close(steps[0])
+		}()
+		changeGear()
+		var stats = c.Stats()
+		assert.Equal(t, 2, stats.Running)
+		assert.Equal(t, uint64(2), stats.Runs)
+		assert.GreaterOrEqual(t, stats.Skipped, uint64(2))
+		assert.Equal(t, float64(2), c.(MetricsReporter).Metrics()["running"])
+		assert.Nil(t, c.Stop())
+		assert.Nil(t, waitForSteps(steps, time.Second))
+		assert.Zero(t, c.Stats().Running)
+	})
+	t.Run("overlap-continuous", func(t *testing.T) {
+		var c = NewPeriodicalJob(0, func(ctx context.Context) error {
+			flapWings()
+			return nil
+		}, PeriodicalOptions{MissedRuns: MissedRunOverlap, MaxOverlap: 2})
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, c.Start())
+			close(steps[0])
+		}()
+		changeGear()
+		assert.Nil(t, c.Stop())
+		assert.Nil(t, waitForSteps(steps, time.Second))
+		var stats = c.Stats()
+		// waits for a running execution to finish instead of skipping executions in a busy loop
+		assert.Zero(t, stats.Skipped)
+		assert.LessOrEqual(t, stats.Runs, uint64(40))
+	})
+	t.Run("overlap-error", func(t *testing.T) {
+		var c = NewPeriodicalJob(10*time.Millisecond, func(ctx context.Context) error {
+			return fmt.Errorf("bad")
+		}, PeriodicalOptions{MissedRuns: MissedRunOverlap})
+		assert.NotNil(t, c.Start())
+		assert.Equal(t, uint64(1), c.Stats().Failures)
+	})
+}
+
+func TestPeriodicalWindows(t *testing.T) {
+	var midnight = func(now time.Time) time.Time {
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	t.Run("deferred-by-blackout", func(t *testing.T) {
+		var now = time.Now()
+		var started = make(chan time.Time, 1)
+		var c = NewPeriodicalJob(time.Hour, func(ctx context.Context) error {
+			started <- time.Now()
+			return nil
+		}, PeriodicalOptions{Blackouts: []Blackout{{From: now.Add(-time.Second), To: now.Add(50 * time.Millisecond)}}})
+		go c.Start()
+		select {
+		case at := <-started:
+			assert.False(t, at.Before(now.Add(50*time.Millisecond)))
+		case <-time.After(time.Second):
+			t.Error("job was not started after the blackout")
+		}
+		assert.Nil(t, c.Stop())
+	})
+	t.Run("cancel-outside-window", func(t *testing.T) {
+		var now = time.Now().UTC()
+		var offset = now.Sub(midnight(now))
+		var c = NewPeriodicalJob(time.Hour, func(ctx context.Context) error {
+			<-ctx.Done()
+			assert.Equal(t, ErrOutsideWindow, context.Cause(ctx))
+			return ctx.Err()
+		}, PeriodicalOptions{
+			Windows:             []TimeWindow{{Start: offset - time.Second, End: offset + 50*time.Millisecond, Location: time.UTC}},
+			CancelOutsideWindow: true,
+		})
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, c.Start())
+			close(steps[0])
+		}()
+		blink()
+		var stats = c.Stats()
+		assert.Equal(t, uint64(1), stats.Runs)
+		assert.Equal(t, uint64(1), stats.Failures)
+		assert.Nil(t, c.Stop())
+		assert.Nil(t, waitForSteps(steps, time.Second))
+	})
+}
+
+func TestPeriodicalFakeClock(t *testing.T) {
+	var epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("period", func(t *testing.T) {
+		var clock = NewFakeClock(epoch)
+		var runs = make(chan time.Time)
+		var c = NewPeriodicalJob(time.Minute, func(ctx context.Context) error {
+			runs <- clock.Now()
+			return nil
+		}, PeriodicalOptions{Clock: clock})
+		go c.Start()
+		assert.Equal(t, epoch, <-runs)
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		assert.Equal(t, epoch.Add(time.Minute), <-runs)
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		assert.Equal(t, epoch.Add(2*time.Minute), <-runs)
+		assert.Nil(t, c.Stop())
+	})
+	t.Run("idle", func(t *testing.T) {
+		var clock = NewFakeClock(epoch)
+		var runs = make(chan time.Time)
+		var c = NewPeriodicalJob(time.Minute, func(ctx context.Context) error {
+			runs <- clock.Now()
+			return nil
+		}, PeriodicalOptions{Clock: clock, Idle: 90 * time.Second})
+		go c.Start()
+		assert.Equal(t, epoch, <-runs)
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		assert.Equal(t, 1, clock.Timers())
+		clock.Advance(30 * time.Second)
+		assert.Equal(t, epoch.Add(90*time.Second), <-runs)
+		assert.Nil(t, c.Stop())
+	})
+	t.Run("shutdown-timeout", func(t *testing.T) {
+		var clock = NewFakeClock(epoch)
+		var running, release = make(chan struct{}), make(chan struct{})
+		var c = NewWorker(func(ctx context.Context) error {
+			close(running)
+			<-release
+			return nil
+		}, WorkerOptions{ShutdownTimeout: time.Minute, Clock: clock})
+		go c.Start()
+		<-running
+		var stopped = make(chan error)
+		go func() {
+			stopped <- c.Stop()
+		}()
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		assert.NotNil(t, <-stopped)
+		close(release)
+	})
+	t.Run("manager-clock", func(t *testing.T) {
+		var clock = NewFakeClock(epoch)
+		var runs = make(chan time.Time)
+		var c = NewPeriodicalJob(time.Minute, func(ctx context.Context) error {
+			runs <- clock.Now()
+			return nil
+		})
+		NewCustomManager(Parameters{Clock: clock}).AddProcess("job", c)
+		go c.Start()
+		<-runs
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		assert.Equal(t, epoch.Add(time.Minute), <-runs)
+		assert.Nil(t, c.Stop())
+	})
 }
@@ -0,0 +1,263 @@
+package procman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PipelineOptions for tuning pipelines.
+type PipelineOptions struct {
+	// Buffer is the number of items which can be waiting between two stages. Defaults to 0, meaning each item is handed
+	// directly from one stage to the next.
+	Buffer int
+	// DrainTimeout is the max time given, after the source stops, for the items in flight to go through the remaining
+	// stages before their context is canceled. Defaults to half the ShutdownTimeout.
+	DrainTimeout time.Duration
+	// ShutdownTimeout sets the timeout to wait for Start() to finish after Stop() is called. Defaults to 60 seconds.
+	ShutdownTimeout time.Duration
+	// Clock used for the drain and shutdown timeouts. Defaults to the manager's clock or the SystemClock.
+	Clock Clock
+}
+
+func (opts *PipelineOptions) merge(new PipelineOptions) {
+	if new.Buffer > 0 {
+		opts.Buffer = new.Buffer
+	}
+	if new.DrainTimeout > 0 {
+		opts.DrainTimeout = new.DrainTimeout
+	}
+	if new.ShutdownTimeout > 0 {
+		opts.ShutdownTimeout = new.ShutdownTimeout
+	}
+	if new.Clock != nil {
+		opts.Clock = new.Clock
+	}
+}
+
+// Pipeline is a builder of a Process made of a source, followed by any number of transforms and ending in a sink, where
+// each stage receives the items produced by the previous one. T is the type of the items produced by the last stage.
+type Pipeline[T any] struct {
+	opts   PipelineOptions
+	source func(ctx context.Context, emit func(item any) error) error
+	stages []pipelineStage
+}
+
+type pipelineStage struct {
+	concurrency int
+	handle      func(ctx context.Context, item any) (any, error)
+}
+
+// NewPipeline starts building a pipeline from a source function, which should produce items by calling emit until ctx
+// is canceled or it runs out of items. Emit blocks until the item is taken by the next stage and only fails if the
+// pipeline is aborted due to an error.
+func NewPipeline[T any](source func(ctx context.Context, emit func(item T) error) error, opts ...PipelineOptions) *Pipeline[T] {
+	var p = &Pipeline[T]{
+		source: func(ctx context.Context, emit func(item any) error) error {
+			return source(ctx, func(item T) error {
+				return emit(item)
+			})
+		},
+	}
+	for _, opt := range opts {
+		p.opts.merge(opt)
+	}
+	return p
+}
+
+// Transform adds a stage to the pipeline which converts each item using fn, handling up to concurrency items at the same
+// time. Items are only kept in order when concurrency is 1.
+func Transform[In, Out any](p *Pipeline[In], concurrency int, fn func(ctx context.Context, item In) (Out, error)) *Pipeline[Out] {
+	return &Pipeline[Out]{
+		opts:   p.opts,
+		source: p.source,
+		stages: append(append([]pipelineStage{}, p.stages...), pipelineStage{
+			concurrency: max(concurrency, 1),
+			handle: func(ctx context.Context, item any) (any, error) {
+				// nil interface values pass through as the zero value
+				v, _ := item.(In)
+				return fn(ctx, v)
+			},
+		}),
+	}
+}
+
+// Sink completes the pipeline with a stage which consumes each item using fn, handling up to concurrency items at the
+// same time, and returns it as a Process.
+//
+// The process runs until the source returns and every item went through all the stages. Stopping it cancels the context
+// of the source only, so that the items in flight are flushed through the remaining stages, for up to the DrainTimeout.
+// The first error returned by any stage aborts the whole pipeline and is returned by Start.
+func (p *Pipeline[T]) Sink(concurrency int, fn func(ctx context.Context, item T) error) Process {
+	var stages = append(append([]pipelineStage{}, p.stages...), pipelineStage{
+		concurrency: max(concurrency, 1),
+		handle: func(ctx context.Context, item any) (any, error) {
+			v, _ := item.(T)
+			return nil, fn(ctx, v)
+		},
+	})
+	var pp = &pipeline{
+		source:    p.source,
+		stages:    stages,
+		opts:      p.opts,
+		links:     make([]chan any, len(stages)),
+		processed: make([]uint64, len(stages)+1),
+	}
+	for i := range pp.links {
+		pp.links[i] = make(chan any, pp.opts.Buffer)
+	}
+	pp.runner = newPeriodical(0, false, func(ctx context.Context) (time.Duration, error) {
+		return 0, pp.run(ctx)
+	}, PeriodicalOptions{
+		Once:            true,
+		ShutdownTimeout: pp.opts.ShutdownTimeout,
+		Clock:           pp.opts.Clock,
+	})
+	if pp.opts.DrainTimeout <= 0 {
+		pp.opts.DrainTimeout = pp.runner.opts.ShutdownTimeout / 2
+	}
+	return pp
+}
+
+type pipeline struct {
+	runner    *periodical
+	source    func(ctx context.Context, emit func(item any) error) error
+	stages    []pipelineStage
+	opts      PipelineOptions
+	links     []chan any
+	processed []uint64
+}
+
+func (p *pipeline) Start() error {
+	return p.runner.Start()
+}
+
+func (p *pipeline) Stop() error {
+	return p.runner.Stop()
+}
+
+func (p *pipeline) manage(env environment) {
+	p.runner.manage(env)
+}
+
+// Metrics of the pipeline: the number of items produced or consumed by each stage, the source being stage 0, and the
+// number of items waiting for each stage.
+func (p *pipeline) Metrics() map[string]float64 {
+	var out = map[string]float64{}
+	for i := range p.processed {
+		out["stage_"+strconv.Itoa(i)+"_processed"] = float64(atomic.LoadUint64(&p.processed[i]))
+	}
+	for i, link := range p.links {
+		out["stage_"+strconv.Itoa(i+1)+"_backlog"] = float64(len(link))
+	}
+	return out
+}
+
+// run starts every stage and waits for all of them to finish. The source runs under ctx while the other stages run under
+// a context which is only canceled once the pipeline is done draining or aborted.
+func (p *pipeline) run(ctx context.Context) error {
+	work, abandon := drainContext(ctx, true, p.opts.DrainTimeout, p.runner, "pipeline")
+	defer abandon()
+	produce, stop := context.WithCancel(ctx)
+	defer stop()
+
+	var failure error
+	var once sync.Once
+	var fail = func(err error) {
+		once.Do(func() {
+			failure = err
+			stop()
+			abandon()
+		})
+	}
+
+	var stages sync.WaitGroup
+	stages.Add(1)
+	go func() {
+		defer stages.Done()
+		defer close(p.links[0])
+		if err := p.produce(produce, work); err != nil && !(ctx.Err() != nil && errors.Is(err, context.Canceled)) {
+			fail(err)
+		}
+	}()
+	for i := range p.stages {
+		var in, out = p.links[i], chan any(nil)
+		if i+1 < len(p.links) {
+			out = p.links[i+1]
+		}
+		var workers sync.WaitGroup
+		for n := 0; n < p.stages[i].concurrency; n++ {
+			workers.Add(1)
+			go func(i int) {
+				defer workers.Done()
+				p.consume(work, i, in, out, fail)
+			}(i)
+		}
+		stages.Add(1)
+		go func() {
+			defer stages.Done()
+			workers.Wait()
+			if out != nil {
+				close(out)
+			}
+		}()
+	}
+	stages.Wait()
+	return failure
+}
+
+// produce runs the source, sending the items it emits to the first stage until the work is abandoned.
+func (p *pipeline) produce(ctx, work context.Context) error {
+	return safely("pipeline source panic", func() error {
+		if err := p.source(ctx, func(item any) error {
+			select {
+			case p.links[0] <- item:
+				atomic.AddUint64(&p.processed[0], 1)
+				return nil
+			case <-work.Done():
+				return fmt.Errorf("pipeline aborted; %w", work.Err())
+			}
+		}); err != nil {
+			return fmt.Errorf("pipeline source failed; %w", err)
+		}
+		return nil
+	})
+}
+
+// consume handles the items received by stage i until its input is closed, passing the results to the next stage if
+// there is one. Items received after the pipeline is aborted are dropped.
+func (p *pipeline) consume(work context.Context, i int, in <-chan any, out chan<- any, fail func(err error)) {
+	for item := range in {
+		if work.Err() != nil {
+			continue
+		}
+		result, err := p.call(work, i, item)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		atomic.AddUint64(&p.processed[i+1], 1)
+		if out == nil {
+			continue
+		}
+		select {
+		case out <- result:
+		case <-work.Done():
+		}
+	}
+}
+
+// call runs the handler of stage i.
+func (p *pipeline) call(ctx context.Context, i int, item any) (result any, err error) {
+	err = safely(fmt.Sprintf("pipeline stage %d panic", i+1), func() error {
+		if result, err = p.stages[i].handle(ctx, item); err != nil {
+			return fmt.Errorf("pipeline stage %d failed; %w", i+1, err)
+		}
+		return nil
+	})
+	return result, err
+}
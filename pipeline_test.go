@@ -0,0 +1,138 @@
+package procman
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipeline(t *testing.T) {
+	var count = func(n int) func(ctx context.Context, emit func(int) error) error {
+		return func(ctx context.Context, emit func(int) error) error {
+			for i := 1; i <= n; i++ {
+				if err := emit(i); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	t.Run("until-source-returns", func(t *testing.T) {
+		var out []string
+		var mux sync.Mutex
+		var p = Transform(
+			Transform(NewPipeline(count(10)), 3, func(ctx context.Context, i int) (int, error) {
+				return i * 2, nil
+			}),
+			1,
+			func(ctx context.Context, i int) (string, error) {
+				return strconv.Itoa(i), nil
+			},
+		).Sink(1, func(ctx context.Context, s string) error {
+			mux.Lock()
+			defer mux.Unlock()
+			out = append(out, s)
+			return nil
+		})
+		assert.Nil(t, p.Start())
+		assert.ElementsMatch(t, []string{"2", "4", "6", "8", "10", "12", "14", "16", "18", "20"}, out)
+
+		var metrics = p.(MetricsReporter).Metrics()
+		for i := 0; i <= 3; i++ {
+			assert.Equal(t, float64(10), metrics["stage_"+strconv.Itoa(i)+"_processed"], "stage %d", i)
+		}
+	})
+	t.Run("nil-interface-items", func(t *testing.T) {
+		var out []error
+		var p = Transform(NewPipeline(func(ctx context.Context, emit func(error) error) error {
+			if err := emit(nil); err != nil {
+				return err
+			}
+			return emit(errDefault)
+		}), 1, func(ctx context.Context, err error) (error, error) {
+			return err, nil
+		}).Sink(1, func(ctx context.Context, err error) error {
+			out = append(out, err)
+			return nil
+		})
+		assert.Nil(t, p.Start())
+		assert.Equal(t, []error{nil, errDefault}, out)
+	})
+	t.Run("stop-flushes-in-flight", func(t *testing.T) {
+		var emitted, sunk int32
+		var p = Transform(NewPipeline(func(ctx context.Context, emit func(int) error) error {
+			for i := 0; ; i++ {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				default:
+				}
+				if err := emit(i); err != nil {
+					return err
+				}
+				atomic.AddInt32(&emitted, 1)
+			}
+		}, PipelineOptions{Buffer: 5}), 2, func(ctx context.Context, i int) (int, error) {
+			flapWings()
+			return i, ctx.Err()
+		}).Sink(1, func(ctx context.Context, i int) error {
+			atomic.AddInt32(&sunk, 1)
+			return ctx.Err()
+		})
+
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, p.Start())
+			close(steps[0])
+		}()
+		changeGear()
+		assert.Nil(t, p.Stop())
+		assert.Nil(t, waitForSteps(steps, time.Second))
+		assert.Equal(t, atomic.LoadInt32(&emitted), atomic.LoadInt32(&sunk))
+	})
+	t.Run("stage-error-aborts", func(t *testing.T) {
+		var p = Transform(NewPipeline(func(ctx context.Context, emit func(int) error) error {
+			for i := 0; ; i++ {
+				if err := emit(i); err != nil {
+					return err
+				}
+			}
+		}), 1, func(ctx context.Context, i int) (int, error) {
+			if i == 5 {
+				return 0, fmt.Errorf("bad item %d", i)
+			}
+			return i, nil
+		}).Sink(1, func(ctx context.Context, i int) error {
+			return nil
+		})
+
+		var steps = makeSteps(1)
+		go func() {
+			var err = p.Start()
+			assert.ErrorContains(t, err, "pipeline stage 1 failed; bad item 5")
+			close(steps[0])
+		}()
+		assert.Nil(t, waitForSteps(steps, time.Second))
+	})
+	t.Run("source-error-aborts", func(t *testing.T) {
+		var p = NewPipeline(func(ctx context.Context, emit func(int) error) error {
+			return fmt.Errorf("no source")
+		}).Sink(1, func(ctx context.Context, i int) error {
+			return nil
+		})
+		assert.ErrorContains(t, p.Start(), "pipeline source failed; no source")
+	})
+	t.Run("panic", func(t *testing.T) {
+		var p = NewPipeline(count(1)).Sink(1, func(ctx context.Context, i int) error {
+			panic("oops")
+		})
+		assert.ErrorContains(t, p.Start(), "pipeline stage 1 panic")
+	})
+}
@@ -0,0 +1,348 @@
+package procman
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RestartPolicy defines what happens to a worker of a pool when its function returns while the pool is running.
+type RestartPolicy int
+
+const (
+	// RestartNever lets the worker exit. If it returned an error, the whole pool stops with that error.
+	RestartNever RestartPolicy = iota
+	// RestartOnFailure restarts the worker if it returned an error or panicked, otherwise lets it exit.
+	RestartOnFailure
+	// RestartAlways restarts the worker whenever it returns.
+	RestartAlways
+)
+
+// WorkerPoolOptions for defining worker pool options.
+type WorkerPoolOptions struct {
+	// ShutdownTimeout sets the timeout to wait for all workers to finish after Stop() is called.
+	ShutdownTimeout time.Duration
+	// Restart policy applied to each worker individually. Defaults to RestartNever.
+	Restart RestartPolicy
+	// MaxRestarts of each worker, after which the pool stops with the worker's last error, if any. Defaults to 0, no limit.
+	MaxRestarts int
+	// RestartDelay is the time to wait before restarting a worker.
+	RestartDelay time.Duration
+	// Clock used for restart delays and the shutdown timeout. Defaults to the manager's clock or the SystemClock.
+	Clock Clock
+}
+
+func (opts *WorkerPoolOptions) merge(new WorkerPoolOptions) {
+	if new.ShutdownTimeout > 0 {
+		opts.ShutdownTimeout = new.ShutdownTimeout
+	}
+	if new.Restart != RestartNever {
+		opts.Restart = new.Restart
+	}
+	if new.MaxRestarts > 0 {
+		opts.MaxRestarts = new.MaxRestarts
+	}
+	if new.RestartDelay > 0 {
+		opts.RestartDelay = new.RestartDelay
+	}
+	if new.Clock != nil {
+		opts.Clock = new.Clock
+	}
+}
+
+// AutoscalingPoolOptions for tuning autoscaling worker pools.
+type AutoscalingPoolOptions struct {
+	WorkerPoolOptions
+	// Min number of workers. Defaults to 1.
+	Min int
+	// Max number of workers. Defaults to Min.
+	Max int
+	// BacklogPerWorker is the backlog a single worker is expected to keep up with, the pool being sized to the backlog
+	// divided by it, rounded up. Defaults to 1.
+	BacklogPerWorker int
+	// Interval between backlog checks. Defaults to 1 second.
+	Interval time.Duration
+	// ScaleUpCooldown is the min time after scaling the pool before adding workers.
+	ScaleUpCooldown time.Duration
+	// ScaleDownCooldown is the min time after scaling the pool before removing workers.
+	ScaleDownCooldown time.Duration
+}
+
+func (opts *AutoscalingPoolOptions) merge(new AutoscalingPoolOptions) {
+	opts.WorkerPoolOptions.merge(new.WorkerPoolOptions)
+	if new.Min > 0 {
+		opts.Min = new.Min
+	}
+	if new.Max > 0 {
+		opts.Max = new.Max
+	}
+	if new.BacklogPerWorker > 0 {
+		opts.BacklogPerWorker = new.BacklogPerWorker
+	}
+	if new.Interval > 0 {
+		opts.Interval = new.Interval
+	}
+	if new.ScaleUpCooldown > 0 {
+		opts.ScaleUpCooldown = new.ScaleUpCooldown
+	}
+	if new.ScaleDownCooldown > 0 {
+		opts.ScaleDownCooldown = new.ScaleDownCooldown
+	}
+}
+
+func (opts *AutoscalingPoolOptions) sanitize() {
+	if opts.Min < 1 {
+		opts.Min = 1
+	}
+	if opts.Max < opts.Min {
+		opts.Max = opts.Min
+	}
+	if opts.BacklogPerWorker < 1 {
+		opts.BacklogPerWorker = 1
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+}
+
+type workerIndexKey struct{}
+
+// WorkerIndex returns the index, from 0 to n-1, of the worker of a pool the context was provided to.
+func WorkerIndex(ctx context.Context) (int, bool) {
+	index, ok := ctx.Value(workerIndexKey{}).(int)
+	return index, ok
+}
+
+type workerPool struct {
+	runner   *periodical
+	main     func(ctx context.Context) error
+	backlog  func() int
+	scaling  AutoscalingPoolOptions
+	size     int32
+	opts     WorkerPoolOptions
+	running  int32
+	restarts uint64
+	failures uint64
+}
+
+// NewWorkerPool creates a wrapper around n copies of a worker function, each expected to return only after ctx.Done() or
+// an error occurs, just like the ones given to NewWorker. Each worker can get its index from the context using WorkerIndex.
+// Workers which return while the pool is running are restarted, or not, individually according to the restart policy.
+// The pool stops once all of its workers exit or as soon as one of them fails and is not restarted, in which case the
+// others are canceled.
+func NewWorkerPool(n int, main func(ctx context.Context) error, opts ...WorkerPoolOptions) Process {
+	if n < 1 {
+		panic("worker pool size must be at least 1")
+	}
+	p := &workerPool{
+		main: main,
+		size: int32(n),
+	}
+	for _, opt := range opts {
+		p.opts.merge(opt)
+	}
+	p.init()
+	return p
+}
+
+// NewAutoscalingPool creates a worker pool, like NewWorkerPool, whose number of workers is periodically adjusted between
+// Min and Max according to the backlog reported by the given function, e.g. the length of a channel or the lag of a
+// consumer. Workers removed from the pool have their context canceled and whatever they return is ignored. Unlike a
+// fixed size pool, it keeps running until stopped or a worker fails, even if all workers exit.
+func NewAutoscalingPool(main func(ctx context.Context) error, backlog func() int, opts ...AutoscalingPoolOptions) Process {
+	p := &workerPool{
+		main:    main,
+		backlog: backlog,
+	}
+	for _, opt := range opts {
+		p.scaling.merge(opt)
+	}
+	p.scaling.sanitize()
+	p.opts = p.scaling.WorkerPoolOptions
+	p.size = int32(p.scaling.Min)
+	p.init()
+	return p
+}
+
+func (p *workerPool) init() {
+	p.runner = newPeriodical(0, false, func(ctx context.Context) (time.Duration, error) {
+		return 0, p.run(ctx)
+	}, PeriodicalOptions{
+		Once:            true,
+		ShutdownTimeout: p.opts.ShutdownTimeout,
+		Clock:           p.opts.Clock,
+	})
+}
+
+func (p *workerPool) Start() error {
+	return p.runner.Start()
+}
+
+func (p *workerPool) Stop() error {
+	return p.runner.Stop()
+}
+
+func (p *workerPool) manage(env environment) {
+	p.runner.manage(env)
+}
+
+// Metrics of the worker pool.
+func (p *workerPool) Metrics() map[string]float64 {
+	return map[string]float64{
+		"size":     float64(atomic.LoadInt32(&p.size)),
+		"running":  float64(atomic.LoadInt32(&p.running)),
+		"restarts": float64(atomic.LoadUint64(&p.restarts)),
+		"failures": float64(atomic.LoadUint64(&p.failures)),
+	}
+}
+
+func (p *workerPool) run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var failure error
+	var once sync.Once
+	var wg sync.WaitGroup
+	// live workers by index, which are removed when they exit so the size of the pool is always the number of workers
+	var workers = map[int]*context.CancelFunc{}
+	var mux sync.Mutex
+	var resize = func() {
+		atomic.StoreInt32(&p.size, int32(len(workers)))
+	}
+	var spawn = func() {
+		mux.Lock()
+		defer mux.Unlock()
+		var index = 0
+		for workers[index] != nil {
+			index++
+		}
+		var wctx, wcancel = context.WithCancel(ctx)
+		var self = &wcancel
+		workers[index] = self
+		resize()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				mux.Lock()
+				defer mux.Unlock()
+				// unless already removed by shrink, in which case the index may have been taken by a new worker
+				if workers[index] == self {
+					delete(workers, index)
+					resize()
+				}
+				wcancel()
+			}()
+			if err := p.worker(ctx, wctx, index); err != nil {
+				once.Do(func() {
+					failure = err
+					cancel()
+				})
+			}
+		}()
+	}
+	var shrink = func() {
+		mux.Lock()
+		defer mux.Unlock()
+		var last = -1
+		for index := range workers {
+			last = max(last, index)
+		}
+		if last < 0 {
+			return
+		}
+		(*workers[last])()
+		delete(workers, last)
+		resize()
+	}
+	for i, n := 0, int(atomic.LoadInt32(&p.size)); i < n; i++ {
+		spawn()
+	}
+	if p.backlog != nil {
+		p.autoscale(ctx, spawn, shrink)
+	}
+	wg.Wait()
+
+	return failure
+}
+
+// autoscale adjusts the size of the pool according to the backlog until ctx is canceled.
+func (p *workerPool) autoscale(ctx context.Context, spawn, shrink func()) {
+	var clock = p.runner.opts.Clock
+	var ticker = clock.NewTicker(p.scaling.Interval)
+	defer ticker.Stop()
+
+	var scaled time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		var backlog = p.backlog()
+		var desired = (backlog + p.scaling.BacklogPerWorker - 1) / p.scaling.BacklogPerWorker
+		desired = min(max(desired, p.scaling.Min), p.scaling.Max)
+		var size, now = int(atomic.LoadInt32(&p.size)), clock.Now()
+		switch {
+		case desired > size && now.Sub(scaled) >= p.scaling.ScaleUpCooldown:
+			for i := size; i < desired; i++ {
+				spawn()
+			}
+		case desired < size && now.Sub(scaled) >= p.scaling.ScaleDownCooldown:
+			for i := size; i > desired; i-- {
+				shrink()
+			}
+		default:
+			continue
+		}
+		p.runner.opts.Dbgf("worker pool scaled from %d to %d workers [backlog:%d]", size, desired, backlog)
+		scaled = now
+	}
+}
+
+// worker runs the worker function with the given index until it exits according to the restart policy or its own
+// context, wctx, is canceled because it was removed from the pool.
+func (p *workerPool) worker(ctx, wctx context.Context, index int) error {
+	wctx = context.WithValue(wctx, workerIndexKey{}, index)
+	for restarts := 0; ; restarts++ {
+		err := p.call(wctx)
+		if err != nil && wctx.Err() == nil {
+			atomic.AddUint64(&p.failures, 1)
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		if wctx.Err() != nil {
+			return nil
+		}
+		switch {
+		case p.opts.Restart == RestartNever:
+			return err
+		case p.opts.Restart == RestartOnFailure && err == nil:
+			return nil
+		case p.opts.MaxRestarts > 0 && restarts >= p.opts.MaxRestarts:
+			if err != nil {
+				return fmt.Errorf("worker %d failed after %d restarts; %w", index, restarts, err)
+			}
+			return nil
+		}
+		p.runner.opts.Dbgf("restarting worker %d", index)
+		atomic.AddUint64(&p.restarts, 1)
+		if p.opts.RestartDelay > 0 {
+			select {
+			case <-wctx.Done():
+				return nil
+			case <-p.runner.opts.Clock.After(p.opts.RestartDelay):
+			}
+		}
+	}
+}
+
+// call runs the worker function, tracking the running workers.
+func (p *workerPool) call(ctx context.Context) error {
+	atomic.AddInt32(&p.running, 1)
+	defer atomic.AddInt32(&p.running, -1)
+	return safely("worker panic", func() error { return p.main(ctx) })
+}
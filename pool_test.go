@@ -0,0 +1,215 @@
+package procman
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerPool(t *testing.T) {
+	t.Run("start-stop", func(t *testing.T) {
+		var indexes sync.Map
+		var pool = NewWorkerPool(4, func(ctx context.Context) error {
+			index, ok := WorkerIndex(ctx)
+			assert.True(t, ok)
+			indexes.Store(index, true)
+			<-ctx.Done()
+			return nil
+		}, WorkerPoolOptions{ShutdownTimeout: time.Second})
+		var steps = makeSteps(2)
+		go func() {
+			assert.Nil(t, pool.Start())
+			close(steps[0])
+		}()
+		go func() {
+			changeGear()
+			assert.Equal(t, float64(4), pool.(MetricsReporter).Metrics()["running"])
+			assert.Nil(t, pool.Stop())
+			close(steps[1])
+		}()
+		assert.Nil(t, waitForSteps(steps, time.Second))
+		for i := 0; i < 4; i++ {
+			_, ok := indexes.Load(i)
+			assert.True(t, ok, "worker %d did not run", i)
+		}
+		_, ok := WorkerIndex(context.Background())
+		assert.False(t, ok)
+	})
+	t.Run("failure-stops-all", func(t *testing.T) {
+		var pool = NewWorkerPool(3, func(ctx context.Context) error {
+			if index, _ := WorkerIndex(ctx); index == 1 {
+				flapWings()
+				return errDefault
+			}
+			<-ctx.Done()
+			return nil
+		})
+		assert.Equal(t, errDefault, pool.Start())
+	})
+	t.Run("restart-on-failure", func(t *testing.T) {
+		var calls int32
+		var pool = NewWorkerPool(2, func(ctx context.Context) error {
+			if index, _ := WorkerIndex(ctx); index == 0 && atomic.AddInt32(&calls, 1) < 3 {
+				panic("not yet")
+			}
+			<-ctx.Done()
+			return nil
+		}, WorkerPoolOptions{Restart: RestartOnFailure, RestartDelay: time.Millisecond})
+		var steps = makeSteps(2)
+		go func() {
+			assert.Nil(t, pool.Start())
+			close(steps[0])
+		}()
+		go func() {
+			changeGear()
+			var metrics = pool.(MetricsReporter).Metrics()
+			assert.Equal(t, float64(2), metrics["restarts"])
+			assert.Equal(t, float64(2), metrics["failures"])
+			assert.Equal(t, float64(2), metrics["running"])
+			assert.Nil(t, pool.Stop())
+			close(steps[1])
+		}()
+		assert.Nil(t, waitForSteps(steps, time.Second))
+	})
+	t.Run("max-restarts", func(t *testing.T) {
+		var calls int32
+		var pool = NewWorkerPool(1, func(ctx context.Context) error {
+			return fmt.Errorf("failure %d", atomic.AddInt32(&calls, 1))
+		}, WorkerPoolOptions{Restart: RestartAlways, MaxRestarts: 2})
+		assert.EqualError(t, pool.Start(), "worker 0 failed after 2 restarts; failure 3")
+	})
+	t.Run("restart-always", func(t *testing.T) {
+		var calls int32
+		var pool = NewWorkerPool(1, func(ctx context.Context) error {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				return nil
+			}
+			<-ctx.Done()
+			return nil
+		}, WorkerPoolOptions{Restart: RestartAlways})
+		go func() {
+			changeGear()
+			assert.Nil(t, pool.Stop())
+		}()
+		assert.Nil(t, pool.Start())
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+}
+
+func TestAutoscalingPool(t *testing.T) {
+	var clock = NewFakeClock(time.Now())
+	var backlog int32
+	var pool = NewAutoscalingPool(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, func() int {
+		return int(atomic.LoadInt32(&backlog))
+	}, AutoscalingPoolOptions{
+		WorkerPoolOptions: WorkerPoolOptions{Clock: clock},
+		Min:               1,
+		Max:               4,
+		BacklogPerWorker:  10,
+		Interval:          time.Second,
+		ScaleDownCooldown: 5 * time.Second,
+	})
+	var metrics = pool.(MetricsReporter)
+	var await = func(running float64) {
+		for i := 0; i < 100 && metrics.Metrics()["running"] != running; i++ {
+			flapWings()
+		}
+		assert.Equal(t, running, metrics.Metrics()["running"])
+	}
+	var tick = func() {
+		clock.Advance(time.Second)
+		flapWings()
+	}
+	var steps = makeSteps(1)
+	go func() {
+		assert.NotNil(t, pool.Start())
+		close(steps[0])
+	}()
+	await(1)
+
+	atomic.StoreInt32(&backlog, 25)
+	clock.BlockUntil(1)
+	tick()
+	await(3)
+	assert.Equal(t, float64(3), metrics.Metrics()["size"])
+
+	atomic.StoreInt32(&backlog, 1000)
+	tick()
+	await(4)
+
+	atomic.StoreInt32(&backlog, 0)
+	for i := 0; i < 3; i++ {
+		tick()
+	}
+	assert.Equal(t, float64(4), metrics.Metrics()["size"])
+	for i := 0; i < 3; i++ {
+		tick()
+	}
+	await(1)
+	assert.Equal(t, float64(1), metrics.Metrics()["size"])
+	assert.Zero(t, metrics.Metrics()["failures"])
+
+	assert.Nil(t, pool.Stop())
+	assert.Nil(t, waitForSteps(steps, time.Second))
+}
+
+func TestAutoscalingPoolExitedWorkers(t *testing.T) {
+	var clock = NewFakeClock(time.Now())
+	var backlog int32 = 40
+	var quit = make(chan struct{})
+	var pool = NewAutoscalingPool(func(ctx context.Context) error {
+		if index, _ := WorkerIndex(ctx); index == 1 {
+			select {
+			case <-quit:
+				return nil
+			case <-ctx.Done():
+			}
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}, func() int {
+		return int(atomic.LoadInt32(&backlog))
+	}, AutoscalingPoolOptions{
+		WorkerPoolOptions: WorkerPoolOptions{Clock: clock, Restart: RestartNever},
+		Min:               1,
+		Max:               4,
+		BacklogPerWorker:  10,
+		Interval:          time.Second,
+	})
+	var metrics = pool.(MetricsReporter)
+	var await = func(running float64) {
+		for i := 0; i < 100 && metrics.Metrics()["running"] != running; i++ {
+			flapWings()
+		}
+		assert.Equal(t, running, metrics.Metrics()["running"])
+	}
+	var steps = makeSteps(1)
+	go func() {
+		pool.Start()
+		close(steps[0])
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	await(4)
+
+	// a worker exiting on its own no longer counts towards the size of the pool
+	close(quit)
+	await(3)
+	assert.Equal(t, float64(3), metrics.Metrics()["size"])
+
+	atomic.StoreInt32(&backlog, 20)
+	clock.Advance(time.Second)
+	await(2)
+	assert.Equal(t, float64(2), metrics.Metrics()["size"])
+
+	assert.Nil(t, pool.Stop())
+	assert.Nil(t, waitForSteps(steps, time.Second))
+}
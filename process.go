@@ -1,8 +1,15 @@
 package procman
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gitlab.com/vredens/go-logger/v2"
 )
 
 // Process is the basic interface for any assynchronous process launched and stopped by the process manager.
@@ -13,6 +20,52 @@ type Process interface {
 	Stop() error
 }
 
+// Pauser is implemented by processes which can suspend their work without being stopped.
+type Pauser interface {
+	// Pause should let any ongoing work finish but skip starting new work until Resume is called.
+	Pause() error
+	// Resume should undo a previous call to Pause.
+	Resume() error
+	// IsPaused returns true while the process is paused.
+	IsPaused() bool
+}
+
+// Drainer is implemented by processes which can stop taking new work before being stopped, such as servers and
+// consumers, so that ongoing work can finish first.
+type Drainer interface {
+	// Drain should make the process stop taking new work while letting ongoing work finish.
+	Drain() error
+	// Drained returns a channel which is closed once the process has no more ongoing work after Drain was called.
+	Drained() <-chan struct{}
+}
+
+// Readier is implemented by processes which are not ready to do their work as soon as they are started, such as servers
+// which still have to bind their address. The manager reports them as starting until they are ready.
+type Readier interface {
+	// Ready returns a channel which is closed once the process is ready.
+	Ready() <-chan struct{}
+}
+
+// MetricsReporter is implemented by processes which expose runtime metrics, such as counters and gauges, by name.
+type MetricsReporter interface {
+	Metrics() map[string]float64
+}
+
+// environment holds the manager facilities shared with the processes provided by this package.
+type environment struct {
+	name    string
+	clock   Clock
+	ctx     context.Context
+	log     logger.SLogger
+	limiter func(name string) *rateLimiter
+	signals []os.Signal
+}
+
+// managed is implemented by the processes provided by this package so the manager can share its facilities with them.
+type managed interface {
+	manage(env environment)
+}
+
 func processStateString(pstate int32) string {
 	switch pstate {
 	case ProcessStateReady:
@@ -27,6 +80,10 @@ func processStateString(pstate int32) string {
 		return "stopped"
 	case ProcessStateAborted:
 		return "aborted"
+	case ProcessStatePaused:
+		return "paused"
+	case ProcessStateStuck:
+		return "stuck"
 	default:
 		return "UNKNOWN"
 	}
@@ -39,12 +96,23 @@ const (
 	ProcessStateStopping
 	ProcessStateStopped
 	ProcessStateAborted
+	ProcessStatePaused
+	ProcessStateStuck
 )
 
 type controller struct {
-	process Process
-	control chan int
-	state   int32
+	process   Process
+	control   chan int
+	state     int32
+	opts      ProcessOptions
+	heartbeat *heartbeat
+	stuck     int32
+	abort     int32
+	// restarting is set while the process is stopped by Restart, so whatever it returns does not stop the manager.
+	restarting int32
+	// halted is set when the process returned during a Restart which did not launch it again.
+	halted int32
+	mux    sync.Mutex
 }
 
 func (controller *controller) Start() (err error) {
@@ -64,3 +132,100 @@ func (controller *controller) Stop() (err error) {
 	}()
 	return controller.process.Stop()
 }
+
+// State of the process as seen by the manager, reporting started processes which are stuck, not yet ready or paused as
+// such.
+func (controller *controller) State() int32 {
+	state := atomic.LoadInt32(&controller.state)
+	if state == ProcessStateStarted && atomic.LoadInt32(&controller.stuck) == 1 {
+		return ProcessStateStuck
+	}
+	if readier, ok := controller.target().(Readier); ok && state == ProcessStateStarted {
+		select {
+		case <-readier.Ready():
+		default:
+			return ProcessStateStarting
+		}
+	}
+	if pauser, ok := controller.target().(Pauser); ok && state == ProcessStateStarted && pauser.IsPaused() {
+		return ProcessStatePaused
+	}
+	return state
+}
+
+// target returns the process being controlled, or its current instance if it is built by a factory.
+func (controller *controller) target() Process {
+	if r, ok := controller.process.(*reusable); ok {
+		if instance := r.current(); instance != nil {
+			return instance
+		}
+	}
+	return controller.process
+}
+
+// pend must be called before launching the process in its own go routine.
+func (controller *controller) pend() {
+	if r, ok := controller.process.(*reusable); ok {
+		r.pend()
+	}
+}
+
+// safely runs fn converting panics to errors, starting with what, since panics in the go routines of the processes
+// provided by this package can not be recovered from by the manager.
+func safely(what string, fn func() error) (err error) {
+	defer func() {
+		if data := recover(); data != nil {
+			err = fmt.Errorf("%s; %+v; %s", what, data, debug.Stack())
+		}
+	}()
+	return fn()
+}
+
+// drainContext returns the context for the ongoing work of a process running under ctx. Once ctx is canceled, it is
+// canceled right away or, if draining, after the drain timeout unless abandoned before.
+func drainContext(ctx context.Context, drain bool, timeout time.Duration, runner *periodical, what string) (context.Context, context.CancelFunc) {
+	work, abandon := context.WithCancel(context.WithoutCancel(ctx))
+	go func() {
+		select {
+		case <-work.Done():
+			return
+		case <-ctx.Done():
+		}
+		if drain {
+			runner.opts.Dbgf("draining %s", what)
+			select {
+			case <-work.Done():
+				return
+			case <-runner.opts.Clock.After(timeout):
+				runner.opts.Dbgf("%s drain timeout exceeded", what)
+			}
+		}
+		abandon()
+	}()
+	return work, abandon
+}
+
+// abandonBuffered calls abandon for the items already buffered in the channel.
+func abandonBuffered[T any](in <-chan T, abandon func(item T)) {
+	for n := len(in); n > 0; n-- {
+		select {
+		case item, ok := <-in:
+			if !ok {
+				return
+			}
+			abandon(item)
+		default:
+			return
+		}
+	}
+}
+
+// isClosed returns true if the channel is closed, without blocking.
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
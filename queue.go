@@ -0,0 +1,218 @@
+package procman
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// QueueWorkerOptions for tuning queue workers.
+type QueueWorkerOptions[T any] struct {
+	// Concurrency is the number of items handled at the same time. Defaults to 1.
+	Concurrency int
+	// Drain, if true, makes Stop wait for the items already buffered in the channel to be handled, for up to DrainTimeout.
+	// Otherwise they are abandoned and in-flight handlers are canceled right away.
+	Drain bool
+	// DrainTimeout is the max time spent draining before abandoning the remaining items. Defaults to half the ShutdownTimeout.
+	DrainTimeout time.Duration
+	// RateLimit limits how often items are handled, across all concurrent handlers. Defaults to no limit.
+	RateLimit RateLimit
+	// OnUnprocessed is called for each item left in the channel buffer when the worker stops.
+	OnUnprocessed func(item T)
+	// ShutdownTimeout sets the timeout to wait for Start() to finish after Stop() is called. Defaults to 60 seconds.
+	ShutdownTimeout time.Duration
+	// Clock used for the drain and shutdown timeouts. Defaults to the manager's clock or the SystemClock.
+	Clock Clock
+}
+
+func (opts *QueueWorkerOptions[T]) merge(new QueueWorkerOptions[T]) {
+	if new.Concurrency > 0 {
+		opts.Concurrency = new.Concurrency
+	}
+	if new.Drain {
+		opts.Drain = new.Drain
+	}
+	if new.DrainTimeout > 0 {
+		opts.DrainTimeout = new.DrainTimeout
+	}
+	if new.RateLimit != (RateLimit{}) {
+		opts.RateLimit = new.RateLimit
+	}
+	if new.OnUnprocessed != nil {
+		opts.OnUnprocessed = new.OnUnprocessed
+	}
+	if new.ShutdownTimeout > 0 {
+		opts.ShutdownTimeout = new.ShutdownTimeout
+	}
+	if new.Clock != nil {
+		opts.Clock = new.Clock
+	}
+}
+
+type queueWorker[T any] struct {
+	runner      *periodical
+	in          <-chan T
+	handle      func(ctx context.Context, item T) error
+	opts        QueueWorkerOptions[T]
+	draining    chan struct{}
+	drained     chan struct{}
+	drain       sync.Once
+	processed   uint64
+	unprocessed uint64
+	inflight    int32
+}
+
+// NewQueueWorker creates a worker which handles the items received from a channel until it is closed or the worker is
+// stopped. Handlers receive a context which is canceled when the worker stops, unless draining. The worker stops with the
+// first error returned by a handler, canceling the others. The worker is a Drainer which stops receiving items when
+// drained, letting the in-flight ones finish, and then returns, leaving the items still buffered unprocessed.
+func NewQueueWorker[T any](in <-chan T, handle func(ctx context.Context, item T) error, opts ...QueueWorkerOptions[T]) Process {
+	q := &queueWorker[T]{
+		in:       in,
+		handle:   handle,
+		draining: make(chan struct{}),
+		drained:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		q.opts.merge(opt)
+	}
+	if q.opts.Concurrency < 1 {
+		q.opts.Concurrency = 1
+	}
+	q.runner = newPeriodical(0, false, func(ctx context.Context) (time.Duration, error) {
+		return 0, q.run(ctx)
+	}, PeriodicalOptions{
+		Once:            true,
+		ShutdownTimeout: q.opts.ShutdownTimeout,
+		Clock:           q.opts.Clock,
+	})
+	if q.opts.DrainTimeout <= 0 {
+		q.opts.DrainTimeout = q.runner.opts.ShutdownTimeout / 2
+	}
+	return q
+}
+
+func (q *queueWorker[T]) Start() error {
+	return q.runner.Start()
+}
+
+func (q *queueWorker[T]) Stop() error {
+	return q.runner.Stop()
+}
+
+func (q *queueWorker[T]) manage(env environment) {
+	q.runner.manage(env)
+}
+
+func (q *queueWorker[T]) Drain() error {
+	q.drain.Do(func() {
+		close(q.draining)
+	})
+	return nil
+}
+
+func (q *queueWorker[T]) Drained() <-chan struct{} {
+	return q.drained
+}
+
+// Metrics of the queue worker.
+func (q *queueWorker[T]) Metrics() map[string]float64 {
+	return map[string]float64{
+		"backlog":     float64(len(q.in)),
+		"inflight":    float64(atomic.LoadInt32(&q.inflight)),
+		"processed":   float64(atomic.LoadUint64(&q.processed)),
+		"unprocessed": float64(atomic.LoadUint64(&q.unprocessed)),
+	}
+}
+
+// run consumes the channel until it is closed, ctx is canceled or the worker is drained. The context given to handlers is
+// only canceled once the worker is done draining.
+func (q *queueWorker[T]) run(ctx context.Context) error {
+	defer close(q.drained)
+	work, abandon := drainContext(ctx, q.opts.Drain, q.opts.DrainTimeout, q.runner, "queue worker")
+	defer abandon()
+
+	limiter, err := q.runner.limiter(q.opts.RateLimit)
+	if err != nil {
+		return err
+	}
+
+	var failure error
+	var once sync.Once
+	var wg sync.WaitGroup
+	for i := 0; i < q.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := q.consume(ctx, work, limiter); err != nil {
+				once.Do(func() {
+					failure = err
+					abandon()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	abandon()
+
+	abandonBuffered(q.in, q.abandon)
+	return failure
+}
+
+// consume handles items until the channel is closed, the worker is drained, the work is abandoned or, unless draining,
+// ctx is canceled.
+func (q *queueWorker[T]) consume(ctx, work context.Context, limiter *rateLimiter) error {
+	for {
+		var item T
+		var ok bool
+		select {
+		case <-work.Done():
+			return nil
+		case <-q.draining:
+			return nil
+		case <-ctx.Done():
+			if !q.opts.Drain {
+				return nil
+			}
+			select {
+			case <-q.draining:
+				return nil
+			case item, ok = <-q.in:
+			default:
+				return nil
+			}
+		case item, ok = <-q.in:
+		}
+		if !ok {
+			return nil
+		}
+		if work.Err() != nil || isClosed(q.draining) || (ctx.Err() != nil && !q.opts.Drain) {
+			q.abandon(item)
+			return nil
+		}
+		// waiting for the limiter only once there is an item keeps idle handlers from holding on to tokens
+		if limiter != nil && limiter.wait(work) != nil {
+			q.abandon(item)
+			return nil
+		}
+		if err := q.call(work, item); err != nil {
+			return err
+		}
+		atomic.AddUint64(&q.processed, 1)
+	}
+}
+
+// call runs the handler, tracking the items in flight.
+func (q *queueWorker[T]) call(ctx context.Context, item T) error {
+	atomic.AddInt32(&q.inflight, 1)
+	defer atomic.AddInt32(&q.inflight, -1)
+	return safely("queue worker panic", func() error { return q.handle(ctx, item) })
+}
+
+func (q *queueWorker[T]) abandon(item T) {
+	atomic.AddUint64(&q.unprocessed, 1)
+	if q.opts.OnUnprocessed != nil {
+		q.opts.OnUnprocessed(item)
+	}
+}
@@ -0,0 +1,126 @@
+package procman
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueWorker(t *testing.T) {
+	var fill = func(n int) chan int {
+		var ch = make(chan int, n)
+		for i := 0; i < n; i++ {
+			ch <- i
+		}
+		return ch
+	}
+
+	t.Run("until-closed", func(t *testing.T) {
+		var sum int64
+		var ch = fill(10)
+		close(ch)
+		var q = NewQueueWorker(ch, func(ctx context.Context, item int) error {
+			atomic.AddInt64(&sum, int64(item))
+			return nil
+		}, QueueWorkerOptions[int]{Concurrency: 3})
+		assert.Nil(t, q.Start())
+		assert.Equal(t, int64(45), sum)
+		assert.Equal(t, float64(10), q.(MetricsReporter).Metrics()["processed"])
+	})
+	t.Run("drain", func(t *testing.T) {
+		var handled, unprocessed int32
+		var q = NewQueueWorker(fill(10), func(ctx context.Context, item int) error {
+			flapWings()
+			if ctx.Err() == nil {
+				atomic.AddInt32(&handled, 1)
+			}
+			return nil
+		}, QueueWorkerOptions[int]{Concurrency: 2, Drain: true, OnUnprocessed: func(int) { atomic.AddInt32(&unprocessed, 1) }})
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, q.Start())
+			close(steps[0])
+		}()
+		flapWings()
+		assert.Nil(t, q.Stop())
+		assert.Nil(t, waitForSteps(steps, time.Second))
+		assert.Equal(t, int32(10), atomic.LoadInt32(&handled))
+		assert.Equal(t, int32(0), atomic.LoadInt32(&unprocessed))
+	})
+	t.Run("drainer", func(t *testing.T) {
+		var started = make(chan struct{}, 10)
+		var canceled, unprocessed int32
+		var q = NewQueueWorker(fill(10), func(ctx context.Context, item int) error {
+			started <- struct{}{}
+			changeGear()
+			if ctx.Err() != nil {
+				atomic.AddInt32(&canceled, 1)
+			}
+			return nil
+		}, QueueWorkerOptions[int]{Concurrency: 2, OnUnprocessed: func(int) { atomic.AddInt32(&unprocessed, 1) }})
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, q.Start())
+			close(steps[0])
+		}()
+		<-started
+		<-started
+		assert.Nil(t, q.(Drainer).Drain())
+		select {
+		case <-q.(Drainer).Drained():
+		case <-time.After(time.Second):
+			t.Fatal("queue worker was not drained")
+		}
+		assert.Nil(t, waitForSteps(steps, time.Second))
+		assert.Len(t, started, 0)
+		assert.Equal(t, int32(0), atomic.LoadInt32(&canceled))
+		assert.Equal(t, int32(8), atomic.LoadInt32(&unprocessed))
+	})
+	t.Run("abandon", func(t *testing.T) {
+		var handled, unprocessed int32
+		var q = NewQueueWorker(fill(10), func(ctx context.Context, item int) error {
+			atomic.AddInt32(&handled, 1)
+			<-ctx.Done()
+			return nil
+		}, QueueWorkerOptions[int]{OnUnprocessed: func(int) { atomic.AddInt32(&unprocessed, 1) }})
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, q.Start())
+			close(steps[0])
+		}()
+		flapWings()
+		assert.Nil(t, q.Stop())
+		assert.Nil(t, waitForSteps(steps, time.Second))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&handled))
+		assert.Equal(t, int32(9), atomic.LoadInt32(&unprocessed))
+	})
+	t.Run("drain-timeout", func(t *testing.T) {
+		var unprocessed int32
+		var q = NewQueueWorker(fill(10), func(ctx context.Context, item int) error {
+			<-ctx.Done()
+			return nil
+		}, QueueWorkerOptions[int]{Drain: true, DrainTimeout: 10 * time.Millisecond, OnUnprocessed: func(int) { atomic.AddInt32(&unprocessed, 1) }})
+		var steps = makeSteps(1)
+		go func() {
+			assert.Nil(t, q.Start())
+			close(steps[0])
+		}()
+		flapWings()
+		assert.Nil(t, q.Stop())
+		assert.Nil(t, waitForSteps(steps, time.Second))
+		assert.Equal(t, int32(9), atomic.LoadInt32(&unprocessed))
+	})
+	t.Run("error", func(t *testing.T) {
+		var q = NewQueueWorker(fill(10), func(ctx context.Context, item int) error {
+			if item == 3 {
+				return errDefault
+			}
+			return nil
+		})
+		assert.Equal(t, errDefault, q.Start())
+		assert.Equal(t, float64(6), q.(MetricsReporter).Metrics()["unprocessed"])
+	})
+}
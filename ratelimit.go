@@ -0,0 +1,87 @@
+package procman
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimit configures a token bucket limiting how often a job runs or an item is handled.
+type RateLimit struct {
+	// Rate is the number of executions allowed per second, on average. Defaults to 0 which disables the limit.
+	Rate float64
+	// Burst is the number of executions allowed in a row, without waiting, after a period of inactivity. Defaults to 1.
+	Burst int
+	// Shared is the name of a limiter registered in the manager using AddRateLimiter, in which case Rate and Burst are
+	// ignored and the limit is shared by every process using it.
+	Shared string
+}
+
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	clock  Clock
+	mux    sync.Mutex
+}
+
+func newRateLimiter(limit RateLimit, clock Clock) *rateLimiter {
+	var burst = float64(max(limit.Burst, 1))
+	return &rateLimiter{
+		rate:   limit.Rate,
+		burst:  burst,
+		tokens: burst,
+		clock:  clock,
+	}
+}
+
+// wait blocks until an execution is allowed or ctx is canceled.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	for {
+		var delay = l.reserve()
+		if delay <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-l.clock.After(delay):
+		}
+	}
+}
+
+// reserve takes a token from the bucket, if there is one, and otherwise returns how long until there is.
+func (l *rateLimiter) reserve() time.Duration {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	var now = l.clock.Now()
+	if !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return max(time.Duration((1-l.tokens)/l.rate*float64(time.Second)), time.Nanosecond)
+}
+
+// AddRateLimiter registers a rate limiter which processes can share by setting its name in their RateLimit options.
+// The Rate and Burst of the limit are used, while Shared is ignored.
+func (manager *Manager) AddRateLimiter(name string, limit RateLimit) {
+	if limit.Rate <= 0 {
+		panic(fmt.Sprintf("rate limiter %s must have a positive rate", name))
+	}
+	manager.mux.Lock()
+	defer manager.mux.Unlock()
+	manager.limiters[name] = newRateLimiter(limit, manager.clock)
+}
+
+func (manager *Manager) limiter(name string) *rateLimiter {
+	manager.mux.RLock()
+	defer manager.mux.RUnlock()
+	return manager.limiters[name]
+}
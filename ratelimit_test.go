@@ -0,0 +1,169 @@
+package procman
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	var clock = NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	var limiter = newRateLimiter(RateLimit{Rate: 2, Burst: 3}, clock)
+
+	for i := 0; i < 3; i++ {
+		assert.Zero(t, limiter.reserve(), "burst %d", i)
+	}
+	assert.Equal(t, 500*time.Millisecond, limiter.reserve())
+
+	clock.Advance(250 * time.Millisecond)
+	assert.Equal(t, 250*time.Millisecond, limiter.reserve())
+	clock.Advance(250 * time.Millisecond)
+	assert.Zero(t, limiter.reserve())
+
+	clock.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.Zero(t, limiter.reserve(), "burst %d after a pause", i)
+	}
+	assert.NotZero(t, limiter.reserve())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, limiter.wait(ctx), context.Canceled)
+}
+
+func TestRateLimitedProcesses(t *testing.T) {
+	var start = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("periodical", func(t *testing.T) {
+		var clock = NewFakeClock(start)
+		var runs int32
+		job := NewPeriodicalJob(0, func(ctx context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		}, PeriodicalOptions{Clock: clock, RateLimit: RateLimit{Rate: 10, Burst: 2}})
+
+		terminated := make(chan struct{})
+		go func() {
+			assert.NoError(t, job.Start())
+			close(terminated)
+		}()
+
+		clock.BlockUntil(1)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&runs))
+		for i := 1; i <= 5; i++ {
+			clock.Advance(100 * time.Millisecond)
+			clock.BlockUntil(1)
+			assert.Equal(t, int32(2+i), atomic.LoadInt32(&runs))
+		}
+
+		assert.NoError(t, job.Stop())
+		assert.NoError(t, waitFor("job", terminated, time.Second))
+	})
+
+	t.Run("shared", func(t *testing.T) {
+		var clock = NewFakeClock(start)
+		var runs int32
+		pman := NewCustomManager(Parameters{Clock: clock})
+		pman.AddRateLimiter("api", RateLimit{Rate: 1, Burst: 4})
+		for _, name := range []string{"a", "b"} {
+			pman.AddProcess(name, NewPeriodicalJob(0, func(ctx context.Context) error {
+				atomic.AddInt32(&runs, 1)
+				return nil
+			}, PeriodicalOptions{RateLimit: RateLimit{Shared: "api"}}))
+		}
+
+		terminated := make(chan struct{})
+		go func() {
+			pman.Start()
+			close(terminated)
+		}()
+
+		clock.BlockUntil(2)
+		assert.Equal(t, int32(4), atomic.LoadInt32(&runs))
+		clock.Advance(time.Second)
+		clock.BlockUntil(2)
+		assert.Equal(t, int32(5), atomic.LoadInt32(&runs))
+
+		pman.Stop()
+		assert.NoError(t, waitFor("manager", terminated, time.Second))
+	})
+
+	t.Run("unregistered", func(t *testing.T) {
+		pman := NewManager()
+		pman.AddProcess("job", NewPeriodicalJob(0, func(ctx context.Context) error {
+			return nil
+		}, PeriodicalOptions{RateLimit: RateLimit{Shared: "nope"}}))
+
+		terminated := make(chan struct{})
+		go func() {
+			pman.Start()
+			close(terminated)
+		}()
+		assert.NoError(t, waitFor("manager", terminated, time.Second))
+		_, scs := pman.StatusCheck()
+		assert.Equal(t, ProcessStateAborted, scs["job"])
+	})
+
+	t.Run("queue", func(t *testing.T) {
+		var clock = NewFakeClock(start)
+		var in = make(chan int, 10)
+		var handled int32
+		for i := 0; i < 10; i++ {
+			in <- i
+		}
+		worker := NewQueueWorker(in, func(ctx context.Context, item int) error {
+			atomic.AddInt32(&handled, 1)
+			return nil
+		}, QueueWorkerOptions[int]{Concurrency: 2, Clock: clock, RateLimit: RateLimit{Rate: 5}})
+
+		terminated := make(chan struct{})
+		go func() {
+			assert.NoError(t, worker.Start())
+			close(terminated)
+		}()
+
+		clock.BlockUntil(2)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&handled))
+		clock.Advance(200 * time.Millisecond)
+		clock.BlockUntil(2)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&handled))
+
+		assert.NoError(t, worker.Stop())
+		assert.NoError(t, waitFor("worker", terminated, time.Second))
+	})
+
+	t.Run("queue-burst", func(t *testing.T) {
+		var clock = NewFakeClock(start)
+		var in = make(chan int, 10)
+		var handled int32
+		worker := NewQueueWorker(in, func(ctx context.Context, item int) error {
+			atomic.AddInt32(&handled, 1)
+			return nil
+		}, QueueWorkerOptions[int]{Concurrency: 4, Clock: clock, RateLimit: RateLimit{Rate: 2, Burst: 1}})
+
+		terminated := make(chan struct{})
+		go func() {
+			assert.NoError(t, worker.Start())
+			close(terminated)
+		}()
+
+		// a burst of items after idle time is handled no faster than the limit, however many handlers are waiting
+		changeGear()
+		clock.Advance(10 * time.Second)
+		changeGear()
+		for i := 0; i < 10; i++ {
+			in <- i
+		}
+		clock.BlockUntil(4)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&handled))
+		clock.Advance(500 * time.Millisecond)
+		clock.BlockUntil(4)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&handled))
+
+		assert.NoError(t, worker.Stop())
+		assert.NoError(t, waitFor("worker", terminated, time.Second))
+	})
+}
@@ -0,0 +1,168 @@
+package procman
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SignalHandlerOptions for tuning signal handlers.
+type SignalHandlerOptions struct {
+	// Concurrent, if true, calls the handler in its own go routine for each signal received, so a slow handler does not
+	// delay the next signals. Otherwise signals are handled one at a time, in the order they were received.
+	Concurrent bool
+	// Buffer is the number of signals which can be waiting to be handled; signals received while the buffer is full are
+	// dropped. Defaults to 10.
+	Buffer int
+	// ShutdownTimeout sets the timeout to wait for Start() to finish after Stop() is called. Defaults to 60 seconds.
+	ShutdownTimeout time.Duration
+	// Clock used for the shutdown timeout. Defaults to the manager's clock or the SystemClock.
+	Clock Clock
+}
+
+func (opts *SignalHandlerOptions) merge(new SignalHandlerOptions) {
+	if new.Concurrent {
+		opts.Concurrent = new.Concurrent
+	}
+	if new.Buffer > 0 {
+		opts.Buffer = new.Buffer
+	}
+	if new.ShutdownTimeout > 0 {
+		opts.ShutdownTimeout = new.ShutdownTimeout
+	}
+	if new.Clock != nil {
+		opts.Clock = new.Clock
+	}
+}
+
+type signalHandler struct {
+	runner   *periodical
+	handle   func(ctx context.Context, sig os.Signal) error
+	sigs     []os.Signal
+	opts     SignalHandlerOptions
+	reserved []os.Signal
+	received uint64
+	handled  uint64
+}
+
+// NewSignalHandler creates a process which calls handle for each of the given signals received, one at a time, using
+// default options. See NewCustomSignalHandler.
+func NewSignalHandler(handle func(ctx context.Context, sig os.Signal) error, sigs ...os.Signal) Process {
+	return NewCustomSignalHandler(SignalHandlerOptions{}, handle, sigs...)
+}
+
+// NewCustomSignalHandler creates a process which calls handle for each of the given signals received, such as SIGHUP for
+// reloading configuration. The context given to handle is canceled when the process is stopped, which waits for running
+// handlers to return. The process stops with the first error returned by handle. When added to a manager, it fails to
+// start if given a signal the manager listens for, like SIGTERM, SIGUSR1 or the UpgradeSignal, since the manager would
+// act on it as well. It panics if no signal is given, since that would relay every signal.
+func NewCustomSignalHandler(opts SignalHandlerOptions, handle func(ctx context.Context, sig os.Signal) error, sigs ...os.Signal) Process {
+	if len(sigs) == 0 {
+		panic("signal handler requires at least one signal")
+	}
+	h := &signalHandler{
+		handle: handle,
+		sigs:   sigs,
+	}
+	h.opts.merge(opts)
+	if h.opts.Buffer <= 0 {
+		h.opts.Buffer = 10
+	}
+	h.runner = newPeriodical(0, false, func(ctx context.Context) (time.Duration, error) {
+		return 0, h.listen(ctx)
+	}, PeriodicalOptions{
+		Once:            true,
+		ShutdownTimeout: h.opts.ShutdownTimeout,
+		Clock:           h.opts.Clock,
+	})
+	return h
+}
+
+func (h *signalHandler) Start() error {
+	return h.runner.Start()
+}
+
+func (h *signalHandler) Stop() error {
+	return h.runner.Stop()
+}
+
+func (h *signalHandler) manage(env environment) {
+	h.reserved = env.signals
+	h.runner.manage(env)
+}
+
+// Metrics of the signal handler.
+func (h *signalHandler) Metrics() map[string]float64 {
+	return map[string]float64{
+		"received": float64(atomic.LoadUint64(&h.received)),
+		"handled":  float64(atomic.LoadUint64(&h.handled)),
+	}
+}
+
+// listen handles signals until ctx is canceled or a handler fails, waiting for running handlers before returning.
+func (h *signalHandler) listen(ctx context.Context) error {
+	for _, sig := range h.sigs {
+		for _, reserved := range h.reserved {
+			if sig == reserved {
+				return fmt.Errorf("%s is handled by the manager", sig)
+			}
+		}
+	}
+	var received = make(chan os.Signal, h.opts.Buffer)
+	signal.Notify(received, h.sigs...)
+	defer signal.Stop(received)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var handlers sync.WaitGroup
+	defer handlers.Wait()
+	var failed = make(chan error, 1)
+
+	for {
+		select {
+		case <-ctx.Done():
+			select {
+			case err := <-failed:
+				return err
+			default:
+				return nil
+			}
+		case err := <-failed:
+			return err
+		case sig := <-received:
+			atomic.AddUint64(&h.received, 1)
+			if !h.opts.Concurrent {
+				if err := h.call(ctx, sig); err != nil {
+					return err
+				}
+				continue
+			}
+			handlers.Add(1)
+			go func() {
+				defer handlers.Done()
+				if err := h.call(ctx, sig); err != nil {
+					select {
+					case failed <- err:
+					default:
+					}
+					cancel()
+				}
+			}()
+		}
+	}
+}
+
+// call runs the handler for a signal.
+func (h *signalHandler) call(ctx context.Context, sig os.Signal) error {
+	defer atomic.AddUint64(&h.handled, 1)
+	return safely("signal handler panic", func() error {
+		if err := h.handle(ctx, sig); err != nil {
+			return fmt.Errorf("signal handler failed on %s; %w", sig, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,169 @@
+//go:build !windows
+// +build !windows
+
+package procman
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignalHandler(t *testing.T) {
+	// SIGWINCH is ignored by default, so a signal sent while no handler is listening does no harm
+	var raise = func(t *testing.T) {
+		assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGWINCH))
+	}
+	var run = func(p Process) chan error {
+		var errs = make(chan error, 1)
+		go func() {
+			errs <- p.Start()
+		}()
+		changeGear()
+		return errs
+	}
+
+	t.Run("serialized", func(t *testing.T) {
+		var received = make(chan os.Signal, 10)
+		var running, overlaps int32
+		var p = NewSignalHandler(func(ctx context.Context, sig os.Signal) error {
+			if atomic.AddInt32(&running, 1) > 1 {
+				atomic.AddInt32(&overlaps, 1)
+			}
+			defer atomic.AddInt32(&running, -1)
+			changeGear()
+			received <- sig
+			return nil
+		}, syscall.SIGWINCH)
+		var errs = run(p)
+		raise(t)
+		flapWings()
+		raise(t)
+		for i := 0; i < 2; i++ {
+			select {
+			case sig := <-received:
+				assert.Equal(t, syscall.SIGWINCH, sig)
+			case <-time.After(time.Second):
+				t.Fatal("signal was not handled")
+			}
+		}
+		assert.Equal(t, int32(0), atomic.LoadInt32(&overlaps))
+		assert.Nil(t, p.Stop())
+		assert.Nil(t, <-errs)
+		assert.Equal(t, float64(2), p.(MetricsReporter).Metrics()["handled"])
+	})
+	t.Run("concurrent", func(t *testing.T) {
+		var started = make(chan struct{}, 10)
+		var p = NewCustomSignalHandler(SignalHandlerOptions{Concurrent: true}, func(ctx context.Context, sig os.Signal) error {
+			started <- struct{}{}
+			<-ctx.Done()
+			return nil
+		}, syscall.SIGWINCH)
+		var errs = run(p)
+		raise(t)
+		flapWings()
+		raise(t)
+		for i := 0; i < 2; i++ {
+			select {
+			case <-started:
+			case <-time.After(time.Second):
+				t.Fatal("handlers did not run concurrently")
+			}
+		}
+		assert.Nil(t, p.Stop())
+		assert.Nil(t, <-errs)
+	})
+	t.Run("error", func(t *testing.T) {
+		var p = NewCustomSignalHandler(SignalHandlerOptions{Concurrent: true}, func(ctx context.Context, sig os.Signal) error {
+			return errDefault
+		}, syscall.SIGWINCH)
+		var errs = run(p)
+		raise(t)
+		select {
+		case err := <-errs:
+			assert.ErrorIs(t, err, errDefault)
+		case <-time.After(time.Second):
+			t.Fatal("signal handler did not stop")
+		}
+	})
+	t.Run("panic", func(t *testing.T) {
+		var p = NewSignalHandler(func(ctx context.Context, sig os.Signal) error {
+			panic("oops")
+		}, syscall.SIGWINCH)
+		var errs = run(p)
+		raise(t)
+		select {
+		case err := <-errs:
+			assert.ErrorContains(t, err, "signal handler panic; oops")
+		case <-time.After(time.Second):
+			t.Fatal("signal handler did not stop")
+		}
+	})
+	t.Run("no-signals", func(t *testing.T) {
+		assert.Panics(t, func() {
+			NewSignalHandler(func(ctx context.Context, sig os.Signal) error { return nil })
+		})
+	})
+	t.Run("manager", func(t *testing.T) {
+		var handled = make(chan struct{}, 1)
+		pman := NewManager()
+		pman.AddProcess("reload", NewSignalHandler(func(ctx context.Context, sig os.Signal) error {
+			handled <- struct{}{}
+			return nil
+		}, syscall.SIGWINCH))
+		terminated := make(chan struct{})
+		go func() {
+			pman.Start()
+			close(terminated)
+		}()
+		changeGear()
+		raise(t)
+		select {
+		case <-handled:
+		case <-time.After(time.Second):
+			t.Fatal("signal was not handled")
+		}
+		pman.Stop()
+		assert.NoError(t, waitFor("manager", terminated, time.Second))
+	})
+	t.Run("manager-sigusr2", func(t *testing.T) {
+		var handled = make(chan struct{}, 1)
+		var handler = func(ctx context.Context, sig os.Signal) error {
+			handled <- struct{}{}
+			return nil
+		}
+
+		// without upgrades, the manager does not listen for SIGUSR2
+		var out syncBuffer
+		pman := NewCustomManager(Parameters{Logger: slog.New(slog.NewTextHandler(&out, nil))})
+		pman.AddProcess("usr2", NewSignalHandler(handler, syscall.SIGUSR2))
+		terminated := make(chan struct{})
+		go func() {
+			pman.Start()
+			close(terminated)
+		}()
+		changeGear()
+		assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR2))
+		select {
+		case <-handled:
+		case <-time.After(time.Second):
+			t.Fatal("signal was not handled")
+		}
+		pman.Stop()
+		assert.NoError(t, waitFor("manager", terminated, time.Second))
+		assert.NotContains(t, out.String(), "upgrade")
+
+		// with upgrades on SIGUSR2, the handler refuses to start
+		pman = NewCustomManager(Parameters{UpgradeSignal: syscall.SIGUSR2})
+		var p = NewSignalHandler(handler, syscall.SIGHUP, syscall.SIGUSR2)
+		pman.AddProcess("usr2", p)
+		assert.ErrorContains(t, p.Start(), "user defined signal 2 is handled by the manager")
+		assert.Len(t, handled, 0)
+	})
+}
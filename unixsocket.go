@@ -0,0 +1,183 @@
+//go:build !windows
+// +build !windows
+
+package procman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+)
+
+// UnixSocketOptions for tuning unix socket servers.
+type UnixSocketOptions struct {
+	// Mode of the socket file. Defaults to leaving the mode given by the umask.
+	Mode os.FileMode
+	// Chown, if true, changes the owner of the socket file to UID and GID.
+	Chown bool
+	// UID of the owner of the socket file when Chown is set; -1 keeps the current one.
+	UID int
+	// GID of the group of the socket file when Chown is set; -1 keeps the current one.
+	GID int
+	// DrainTimeout is the max time given to open connections to finish before they are closed when stopping servers
+	// with a connection handler. Defaults to half the ShutdownTimeout.
+	DrainTimeout time.Duration
+	// ShutdownTimeout is the max time to wait, when stopping, for the server to finish. Defaults to the one of
+	// NewHTTPServer or NewListenerServer.
+	ShutdownTimeout time.Duration
+	// Clock used for the drain and shutdown timeouts. Defaults to the manager's clock or the SystemClock.
+	Clock Clock
+}
+
+func (opts *UnixSocketOptions) merge(new UnixSocketOptions) {
+	if new.Mode != 0 {
+		opts.Mode = new.Mode
+	}
+	if new.Chown {
+		opts.Chown, opts.UID, opts.GID = new.Chown, new.UID, new.GID
+	}
+	if new.DrainTimeout > 0 {
+		opts.DrainTimeout = new.DrainTimeout
+	}
+	if new.ShutdownTimeout > 0 {
+		opts.ShutdownTimeout = new.ShutdownTimeout
+	}
+	if new.Clock != nil {
+		opts.Clock = new.Clock
+	}
+}
+
+type unixServer struct {
+	Server
+	ln *net.UnixListener
+}
+
+// NewUnixHTTPServer listens on the unix socket at path and creates a process serving HTTP requests on it with handler,
+// like NewHTTPServer does. A socket file left behind by a process which crashed is removed first, as long as nobody is
+// listening on it. The socket file is removed when the server is stopped.
+func NewUnixHTTPServer(path string, handler http.Handler, opts ...UnixSocketOptions) (Server, error) {
+	var options = unixSocketOptions(opts)
+	ln, err := ListenUnix(path, options)
+	if err != nil {
+		return nil, err
+	}
+	return &unixServer{
+		Server: NewHTTPServer(&http.Server{Handler: handler}, HTTPServerOptions{
+			Listener:        ln,
+			ShutdownTimeout: options.ShutdownTimeout,
+			Clock:           options.Clock,
+		}),
+		ln: ln,
+	}, nil
+}
+
+// NewUnixSocketServer listens on the unix socket at path and creates a process handling each connection with handle,
+// like NewListenerServer does. Otherwise it behaves just like NewUnixHTTPServer.
+func NewUnixSocketServer(path string, handle func(ctx context.Context, conn net.Conn), opts ...UnixSocketOptions) (Server, error) {
+	var options = unixSocketOptions(opts)
+	ln, err := ListenUnix(path, options)
+	if err != nil {
+		return nil, err
+	}
+	return &unixServer{
+		Server: NewListenerServer(ln, handle, ListenerServerOptions{
+			DrainTimeout:    options.DrainTimeout,
+			ShutdownTimeout: options.ShutdownTimeout,
+			Clock:           options.Clock,
+		}),
+		ln: ln,
+	}, nil
+}
+
+func unixSocketOptions(opts []UnixSocketOptions) UnixSocketOptions {
+	var options UnixSocketOptions
+	for _, opt := range opts {
+		options.merge(opt)
+	}
+	return options
+}
+
+// ListenUnix listens on the unix socket at path, removing the socket file left behind by a process which crashed, and
+// sets the mode and ownership of the socket file. It fails if the file exists and is not a socket, or if another process
+// is listening on it. The socket file is removed when the listener is closed.
+func ListenUnix(path string, opts ...UnixSocketOptions) (*net.UnixListener, error) {
+	var options = unixSocketOptions(opts)
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	if options.Mode != 0 {
+		if err := os.Chmod(path, options.Mode); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("failed to change mode of socket %s; %w", path, err)
+		}
+	}
+	if options.Chown {
+		if err := os.Lchown(path, options.UID, options.GID); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("failed to change owner of socket %s; %w", path, err)
+		}
+	}
+	return ln, nil
+}
+
+// removeStaleSocket removes the socket file at path if nobody is listening on it.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s already exists and is not a socket", path)
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s is in use by another process", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("failed to check if socket %s is stale; %w", path, err)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale socket %s; %w", path, err)
+	}
+	return nil
+}
+
+// Stop stops the server and closes its listener, which removes the socket file, even if the server was never started.
+func (s *unixServer) Stop() error {
+	err := s.Server.Stop()
+	s.ln.Close()
+	return err
+}
+
+func (s *unixServer) manage(env environment) {
+	if m, ok := s.Server.(managed); ok {
+		m.manage(env)
+	}
+}
+
+func (s *unixServer) Drain() error {
+	return s.Server.(Drainer).Drain()
+}
+
+func (s *unixServer) Drained() <-chan struct{} {
+	return s.Server.(Drainer).Drained()
+}
+
+// Metrics of the server.
+func (s *unixServer) Metrics() map[string]float64 {
+	return s.Server.(MetricsReporter).Metrics()
+}
@@ -0,0 +1,151 @@
+//go:build !windows
+// +build !windows
+
+package procman
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnixSocketServer(t *testing.T) {
+	var socket = func(t *testing.T) string {
+		return filepath.Join(t.TempDir(), "api.sock")
+	}
+	var run = func(srv Server) chan error {
+		var errs = make(chan error, 1)
+		go func() {
+			errs <- srv.Start()
+		}()
+		return errs
+	}
+
+	t.Run("http", func(t *testing.T) {
+		var path = socket(t)
+		srv, err := NewUnixHTTPServer(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "pong")
+		}), UnixSocketOptions{Mode: 0o600})
+		assert.NoError(t, err)
+		info, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+		var errs = run(srv)
+		assert.Nil(t, waitReady(srv))
+		var client = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		}}
+		res, err := client.Get("http://unix/ping")
+		assert.NoError(t, err)
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal(t, "pong", string(body))
+		client.CloseIdleConnections()
+
+		assert.Nil(t, srv.Stop())
+		assert.Nil(t, <-errs)
+		_, err = os.Lstat(path)
+		assert.True(t, os.IsNotExist(err), "socket file was not removed")
+	})
+	t.Run("connection-handler", func(t *testing.T) {
+		var path = socket(t)
+		srv, err := NewUnixSocketServer(path, func(ctx context.Context, conn net.Conn) {
+			var scanner = bufio.NewScanner(conn)
+			for scanner.Scan() {
+				conn.Write(append(scanner.Bytes(), '\n'))
+			}
+		}, UnixSocketOptions{Chown: true, UID: os.Getuid(), GID: -1})
+		assert.NoError(t, err)
+		var errs = run(srv)
+		assert.Nil(t, waitReady(srv))
+
+		conn, err := net.Dial("unix", path)
+		assert.NoError(t, err)
+		conn.Write([]byte("ping\n"))
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "ping\n", line)
+		conn.Close()
+
+		assert.Nil(t, srv.Stop())
+		assert.Nil(t, <-errs)
+		_, err = os.Lstat(path)
+		assert.True(t, os.IsNotExist(err), "socket file was not removed")
+	})
+	t.Run("stale-socket", func(t *testing.T) {
+		var path = socket(t)
+		ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+		assert.NoError(t, err)
+		// leave the socket file behind, like a crashed process does
+		ln.SetUnlinkOnClose(false)
+		ln.Close()
+		_, err = os.Lstat(path)
+		assert.NoError(t, err)
+
+		srv, err := NewUnixSocketServer(path, func(ctx context.Context, conn net.Conn) {})
+		assert.NoError(t, err)
+		assert.Nil(t, srv.Stop())
+	})
+	t.Run("socket-in-use", func(t *testing.T) {
+		var path = socket(t)
+		ln, err := net.Listen("unix", path)
+		assert.NoError(t, err)
+		defer ln.Close()
+
+		_, err = NewUnixSocketServer(path, func(ctx context.Context, conn net.Conn) {})
+		assert.ErrorContains(t, err, "in use by another process")
+	})
+	t.Run("not-a-socket", func(t *testing.T) {
+		var path = socket(t)
+		assert.NoError(t, os.WriteFile(path, []byte("data"), 0o600))
+
+		_, err := NewUnixSocketServer(path, func(ctx context.Context, conn net.Conn) {})
+		assert.ErrorContains(t, err, "is not a socket")
+		_, err = os.Lstat(path)
+		assert.NoError(t, err)
+	})
+	t.Run("stop-before-start", func(t *testing.T) {
+		var path = socket(t)
+		srv, err := NewUnixHTTPServer(path, http.NotFoundHandler())
+		assert.NoError(t, err)
+		assert.Nil(t, srv.Stop())
+		_, err = os.Lstat(path)
+		assert.True(t, os.IsNotExist(err), "socket file was not removed")
+	})
+	t.Run("manager", func(t *testing.T) {
+		var path = socket(t)
+		srv, err := NewUnixSocketServer(path, func(ctx context.Context, conn net.Conn) {
+			<-ctx.Done()
+		})
+		assert.NoError(t, err)
+		// the open connection keeps the server from being drained until the drain timeout
+		pman := NewCustomManager(Parameters{DrainTimeout: 100 * time.Millisecond})
+		pman.AddProcess("sidecar", srv)
+		terminated := make(chan struct{})
+		go func() {
+			pman.Start()
+			close(terminated)
+		}()
+		assert.Nil(t, waitReady(srv))
+		conn, err := net.Dial("unix", path)
+		assert.NoError(t, err)
+		defer conn.Close()
+		changeGear()
+		assert.Equal(t, float64(1), srv.(MetricsReporter).Metrics()["connections"])
+		pman.Stop()
+		assert.NoError(t, waitFor("manager", terminated, 5*time.Second))
+		_, err = os.Lstat(path)
+		assert.True(t, os.IsNotExist(err), "socket file was not removed")
+	})
+}
@@ -0,0 +1,147 @@
+package procman
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// envReadyFD is the environment variable with the file descriptor an upgraded process uses to tell its parent it is ready.
+const envReadyFD = "PROCMAN_READY_FD"
+
+// readyFile holds the file an upgraded process uses to tell its parent it is ready, which is only collected once since
+// the environment variable describing it is removed so it is not passed on to child processes.
+var readyFile struct {
+	once sync.Once
+	file *os.File
+	mux  sync.Mutex
+}
+
+func takeReadyFile() *os.File {
+	readyFile.once.Do(func() {
+		var env = os.Getenv(envReadyFD)
+		os.Unsetenv(envReadyFD)
+		if fd, err := strconv.Atoi(env); err == nil && fd >= listenFDsStart {
+			readyFile.file = inheritFile(fd, "ready")
+		}
+	})
+	readyFile.mux.Lock()
+	defer readyFile.mux.Unlock()
+	var file = readyFile.file
+	readyFile.file = nil
+	return file
+}
+
+// notifyReady tells the parent process, if this process is the result of an upgrade, that every process is ready.
+func (manager *Manager) notifyReady(done <-chan struct{}) {
+	var file = takeReadyFile()
+	if file == nil {
+		return
+	}
+	defer file.Close()
+
+	manager.mux.RLock()
+	var pending []<-chan struct{}
+	for _, process := range manager.processes {
+		if readier, ok := process.target().(Readier); ok {
+			pending = append(pending, readier.Ready())
+		}
+	}
+	manager.mux.RUnlock()
+
+	for _, ready := range pending {
+		select {
+		case <-ready:
+		case <-done:
+			return
+		}
+	}
+	if _, err := file.Write([]byte("ready\n")); err != nil {
+		manager.mlog.Errorf("process manager: failed to notify parent process (cause: %+v)", err)
+	}
+}
+
+// upgradeBinary starts a new instance of the running binary, with the same arguments, handing over every listener taken
+// using Listen, and waits for it to be ready.
+func (manager *Manager) upgradeBinary() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	var files []*os.File
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	manager.mux.RLock()
+	for name, ln := range manager.listeners {
+		f, ok := ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			manager.mux.RUnlock()
+			return fmt.Errorf("listener %s can not be handed over", name)
+		}
+		file, err := f.File()
+		if err != nil {
+			manager.mux.RUnlock()
+			return fmt.Errorf("failed to hand over listener %s; %w", name, err)
+		}
+		if unix, ok := ln.(*net.UnixListener); ok {
+			// the socket file must outlive this process
+			unix.SetUnlinkOnClose(false)
+		}
+		names, files = append(names, name), append(files, file)
+	}
+	manager.mux.RUnlock()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var cmd = exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(files, w)
+	cmd.Env = append(os.Environ(),
+		envInheritedFDs+"="+strconv.Itoa(len(files)),
+		envInheritedFDNames+"="+strings.Join(names, ":"),
+		envReadyFD+"="+strconv.Itoa(listenFDsStart+len(files)),
+	)
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return fmt.Errorf("failed to start upgraded process; %w", err)
+	}
+	manager.mlog.Infof("process manager: started upgraded process [pid:%d]", cmd.Process.Pid)
+
+	var exited, ready = make(chan error, 1), make(chan bool, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	go func() {
+		var buf = make([]byte, 16)
+		n, _ := r.Read(buf)
+		ready <- n > 0
+	}()
+
+	select {
+	case ok := <-ready:
+		if !ok {
+			cmd.Process.Kill()
+			return fmt.Errorf("upgraded process closed without being ready")
+		}
+		return nil
+	case err := <-exited:
+		return fmt.Errorf("upgraded process exited without being ready; %v", err)
+	case <-manager.clock.After(manager.upgrade):
+		cmd.Process.Kill()
+		return fmt.Errorf("upgraded process not ready after %s", manager.upgrade)
+	}
+}
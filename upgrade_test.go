@@ -0,0 +1,84 @@
+//go:build !windows
+// +build !windows
+
+package procman
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// envUpgradeChild is set for the test binary started by TestUpgrade, making it behave as the upgraded process.
+const envUpgradeChild = "PROCMAN_TEST_UPGRADE_CHILD"
+
+func init() {
+	// the upgraded test binary runs no tests, it only acts as the new instance of the upgraded process
+	if os.Getenv(envUpgradeChild) != "" {
+		upgradeChild()
+		os.Exit(0)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	var client = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}, Timeout: time.Second}
+	var get = func(url string) (string, error) {
+		res, err := client.Get(url)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		return string(body), err
+	}
+
+	pman := NewCustomManager(Parameters{UpgradeSignal: syscall.SIGUSR2})
+	ln, err := pman.Listen("http", "tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	var url = "http://" + ln.Addr().String()
+	var srv = NewHTTPServer(&http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "parent")
+	})}, HTTPServerOptions{Listener: ln})
+	pman.AddProcess("http", srv)
+
+	terminated := make(chan struct{})
+	go func() {
+		pman.Start()
+		close(terminated)
+	}()
+	assert.Nil(t, waitReady(srv))
+	body, err := get(url)
+	assert.NoError(t, err)
+	assert.Equal(t, "parent", body)
+
+	t.Setenv(envUpgradeChild, "1")
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR2))
+	assert.NoError(t, waitFor("manager", terminated, 10*time.Second))
+
+	body, err = get(url)
+	assert.NoError(t, err)
+	assert.Equal(t, "child", body)
+}
+
+// upgradeChild serves a single request on the listener handed over by the parent and stops.
+func upgradeChild() {
+	pman := NewManager()
+	ln, err := pman.Listen("http", "tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	pman.AddProcess("http", NewHTTPServer(&http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "child")
+		go pman.Stop()
+	})}, HTTPServerOptions{Listener: ln}))
+	go func() {
+		<-time.After(5 * time.Second)
+		pman.Stop()
+	}()
+	pman.Start()
+}
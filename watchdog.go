@@ -0,0 +1,130 @@
+package procman
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// StuckAction is what the manager does with a process which stopped sending heartbeats.
+type StuckAction int
+
+const (
+	// StuckLog only marks the process as stuck and logs a dump of its go routines. This is the default.
+	StuckLog StuckAction = iota
+	// StuckRestart also restarts the process, which must have been added using AddProcessFactory.
+	StuckRestart
+	// StuckAbort also aborts the process and stops the manager.
+	StuckAbort
+)
+
+// labelProcess is the profiler label holding the name of the process a go routine belongs to.
+const labelProcess = "procman.process"
+
+type heartbeatKey struct{}
+
+// heartbeat holds the time of the last heartbeat of a process.
+type heartbeat struct {
+	clock Clock
+	last  int64
+}
+
+// Heartbeat signals the manager that the process running under ctx is still making progress. Processes with a
+// HeartbeatTimeout which do not call it within the timeout are marked as stuck. The context given to the jobs of the
+// processes provided by this package carries the heartbeat, for any other context this is a no-op.
+func Heartbeat(ctx context.Context) {
+	if h, ok := ctx.Value(heartbeatKey{}).(*heartbeat); ok {
+		h.beat()
+	}
+}
+
+func (h *heartbeat) beat() {
+	atomic.StoreInt64(&h.last, h.clock.Now().UnixNano())
+}
+
+func (h *heartbeat) since(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&h.last)))
+}
+
+// watchdog checks the heartbeats of every process with a HeartbeatTimeout until done is closed.
+func (manager *Manager) watchdog(done <-chan struct{}) {
+	var interval time.Duration
+	for _, process := range manager.processes {
+		if t := process.opts.HeartbeatTimeout; t > 0 && (interval == 0 || t/2 < interval) {
+			interval = t / 2
+		}
+	}
+	if interval <= 0 {
+		return
+	}
+
+	ticker := manager.clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C():
+			manager.mux.RLock()
+			for name, process := range manager.processes {
+				manager.inspect(name, process)
+			}
+			manager.mux.RUnlock()
+		}
+	}
+}
+
+// inspect marks the process as stuck if its heartbeat timed out and acts on it.
+func (manager *Manager) inspect(name string, process *controller) {
+	if process.opts.HeartbeatTimeout <= 0 {
+		return
+	}
+	if state := process.State(); state != ProcessStateStarted && state != ProcessStateStuck {
+		// only running processes are expected to send heartbeats
+		process.heartbeat.beat()
+		return
+	}
+	silence := process.heartbeat.since(manager.clock.Now())
+	if silence < process.opts.HeartbeatTimeout {
+		if atomic.CompareAndSwapInt32(&process.stuck, 1, 0) {
+			manager.plog.Infof("[process:%s]: recovered", name)
+		}
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&process.stuck, 0, 1) {
+		return
+	}
+	manager.plog.Errorf("[process:%s]: stuck [silence:%s]\n%s", name, silence, dump(name))
+
+	switch process.opts.OnStuck {
+	case StuckRestart:
+		go func() {
+			if err := manager.Restart(name); err != nil {
+				manager.plog.Errorf("[process:%s]: failed to restart stuck process (cause: %+v)", name, err)
+			}
+		}()
+	case StuckAbort:
+		atomic.StoreInt32(&process.abort, 1)
+		go manager.Stop()
+	}
+}
+
+// dump returns the stack traces of the go routines labeled as belonging to the named process.
+func dump(name string) []byte {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return []byte(err.Error())
+	}
+	var label = []byte(strconv.Quote(labelProcess) + ":" + strconv.Quote(name))
+	var out bytes.Buffer
+	for _, block := range bytes.Split(buf.Bytes(), []byte("\n\n")) {
+		if bytes.Contains(block, label) {
+			out.Write(block)
+			out.WriteString("\n\n")
+		}
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,146 @@
+package procman
+
+import (
+	"context"
+	"runtime/pprof"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchdog(t *testing.T) {
+	var start = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// waitTicker waits for the watchdog ticker to be registered in the clock
+	var waitTicker = func(clock *FakeClock) {
+		for i := 0; i < 100 && clock.Timers() == 0; i++ {
+			flapWings()
+		}
+	}
+	// tick advances the clock one watchdog interval and lets the watchdog run
+	var tick = func(clock *FakeClock) {
+		clock.Advance(500 * time.Millisecond)
+		changeGear()
+	}
+
+	t.Run("stuck-and-recovered", func(t *testing.T) {
+		var clock = NewFakeClock(start)
+		var beats = make(chan struct{})
+		pman := NewCustomManager(Parameters{Clock: clock})
+		pman.AddProcess("worker", NewWorker(func(ctx context.Context) error {
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-beats:
+					Heartbeat(ctx)
+				}
+			}
+		}), ProcessOptions{HeartbeatTimeout: time.Second})
+
+		terminated := make(chan struct{})
+		go func() {
+			pman.Start()
+			close(terminated)
+		}()
+		waitTicker(clock)
+
+		tick(clock)
+		ok, scs := pman.StatusCheck()
+		assert.True(t, ok)
+		assert.Equal(t, ProcessStateStarted, scs["worker"])
+
+		tick(clock)
+		tick(clock)
+		ok, scs = pman.StatusCheck()
+		assert.False(t, ok)
+		assert.Equal(t, ProcessStateStuck, scs["worker"], processStateString(scs["worker"]))
+
+		beats <- struct{}{}
+		flapWings()
+		tick(clock)
+		ok, scs = pman.StatusCheck()
+		assert.True(t, ok)
+		assert.Equal(t, ProcessStateStarted, scs["worker"], processStateString(scs["worker"]))
+
+		pman.Stop()
+		assert.NoError(t, waitFor("manager", terminated, time.Second))
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		var clock = NewFakeClock(start)
+		pman := NewCustomManager(Parameters{Clock: clock})
+		pman.AddProcess("worker", NewWorker(func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}), ProcessOptions{HeartbeatTimeout: time.Second, OnStuck: StuckAbort})
+
+		terminated := make(chan struct{})
+		go func() {
+			pman.Start()
+			close(terminated)
+		}()
+		waitTicker(clock)
+
+		for i := 0; i < 3; i++ {
+			tick(clock)
+		}
+		assert.NoError(t, waitFor("manager", terminated, time.Second))
+		_, scs := pman.StatusCheck()
+		assert.Equal(t, ProcessStateAborted, scs["worker"], processStateString(scs["worker"]))
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		var clock = NewFakeClock(start)
+		var builds int32
+		pman := NewCustomManager(Parameters{Clock: clock})
+		pman.AddProcessFactory("worker", func() Process {
+			atomic.AddInt32(&builds, 1)
+			return NewWorker(func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			})
+		}, ProcessOptions{HeartbeatTimeout: time.Second, OnStuck: StuckRestart})
+
+		terminated := make(chan struct{})
+		go func() {
+			pman.Start()
+			close(terminated)
+		}()
+		waitTicker(clock)
+
+		for i := 0; i < 3; i++ {
+			tick(clock)
+		}
+		changeGear()
+		assert.Equal(t, int32(2), atomic.LoadInt32(&builds))
+		_, scs := pman.StatusCheck()
+		assert.Equal(t, ProcessStateStarted, scs["worker"], processStateString(scs["worker"]))
+
+		pman.Stop()
+		assert.NoError(t, waitFor("manager", terminated, time.Second))
+	})
+
+	t.Run("restart-requires-factory", func(t *testing.T) {
+		pman := NewManager()
+		assert.Panics(t, func() {
+			pman.AddProcess("sample", &SampleService{}, ProcessOptions{OnStuck: StuckRestart})
+		})
+	})
+
+	t.Run("dump", func(t *testing.T) {
+		var release = make(chan struct{})
+		var running = make(chan struct{})
+		go pprof.Do(context.Background(), pprof.Labels(labelProcess, "blocked"), func(context.Context) {
+			close(running)
+			<-release
+		})
+		<-running
+		defer close(release)
+
+		assert.Contains(t, string(dump("blocked")), "TestWatchdog")
+		assert.Empty(t, dump("nobody"))
+	})
+}
@@ -0,0 +1,293 @@
+package procman
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// FileOp is the kind of change detected on a file.
+type FileOp int
+
+const (
+	// FileCreated means the file did not exist in the previous scan.
+	FileCreated FileOp = iota + 1
+	// FileModified means the modification time, size or mode of the file changed since the previous scan.
+	FileModified
+	// FileDeleted means the file no longer exists.
+	FileDeleted
+)
+
+func (op FileOp) String() string {
+	switch op {
+	case FileCreated:
+		return "created"
+	case FileModified:
+		return "modified"
+	case FileDeleted:
+		return "deleted"
+	}
+	return "unknown"
+}
+
+// FileEvent describes a change detected on a watched file.
+type FileEvent struct {
+	// Path of the file, as given to the watcher for files or joined with the watched directory for its entries.
+	Path string
+	// Op is the kind of change.
+	Op FileOp
+}
+
+// FileWatcherOptions for tuning file watchers.
+type FileWatcherOptions struct {
+	// Interval between scans of the watched paths. Defaults to 1 second.
+	Interval time.Duration
+	// Debounce is the time without further changes to wait for before delivering a batch of events. Defaults to 100 milliseconds.
+	Debounce time.Duration
+	// MaxWait is the max time a change waits to be delivered while further changes keep resetting the Debounce time.
+	// Defaults to 10 times the Debounce.
+	MaxWait time.Duration
+	// Inotify, if true, uses inotify on Linux to scan the watched paths as soon as they change, instead of waiting for
+	// the next scan. Scans still run every Interval, catching changes inotify misses, such as on paths created later.
+	// Has no effect on other platforms.
+	Inotify bool
+	// ShutdownTimeout sets the timeout to wait for Start() to finish after Stop() is called. Defaults to 60 seconds.
+	ShutdownTimeout time.Duration
+	// Clock used for scans and debouncing. Defaults to the manager's clock or the SystemClock.
+	Clock Clock
+}
+
+func (opts *FileWatcherOptions) merge(new FileWatcherOptions) {
+	if new.Interval > 0 {
+		opts.Interval = new.Interval
+	}
+	if new.Debounce > 0 {
+		opts.Debounce = new.Debounce
+	}
+	if new.MaxWait > 0 {
+		opts.MaxWait = new.MaxWait
+	}
+	if new.Inotify {
+		opts.Inotify = new.Inotify
+	}
+	if new.ShutdownTimeout > 0 {
+		opts.ShutdownTimeout = new.ShutdownTimeout
+	}
+	if new.Clock != nil {
+		opts.Clock = new.Clock
+	}
+}
+
+// fileStat holds what is compared between scans to detect modified files.
+type fileStat struct {
+	modTime time.Time
+	size    int64
+	mode    os.FileMode
+}
+
+type fileWatcher struct {
+	runner  *periodical
+	paths   []string
+	handle  func(ctx context.Context, events []FileEvent) error
+	opts    FileWatcherOptions
+	files   map[string]fileStat
+	batches uint64
+	events  uint64
+}
+
+// NewFileWatcher creates a process which watches files and directories for changes, calling handle with the batch of
+// events detected once no more changes happen for the Debounce time, or the MaxWait time after the first of them if
+// changes keep happening. Directories are watched for changes on their direct entries; paths which do not exist yet are
+// watched for their creation. Changes are detected by scanning the paths, so only the net change to a file between scans
+// is reported. The files existing when the watcher starts produce no events. The watcher stops with the first error
+// returned by handle.
+func NewFileWatcher(paths []string, handle func(ctx context.Context, events []FileEvent) error, opts ...FileWatcherOptions) Process {
+	w := &fileWatcher{
+		paths:  paths,
+		handle: handle,
+	}
+	for _, opt := range opts {
+		w.opts.merge(opt)
+	}
+	if w.opts.Interval <= 0 {
+		w.opts.Interval = time.Second
+	}
+	if w.opts.Debounce <= 0 {
+		w.opts.Debounce = 100 * time.Millisecond
+	}
+	if w.opts.MaxWait <= 0 {
+		w.opts.MaxWait = 10 * w.opts.Debounce
+	}
+	w.runner = newPeriodical(0, false, func(ctx context.Context) (time.Duration, error) {
+		return 0, w.watch(ctx)
+	}, PeriodicalOptions{
+		Once:            true,
+		ShutdownTimeout: w.opts.ShutdownTimeout,
+		Clock:           w.opts.Clock,
+	})
+	return w
+}
+
+func (w *fileWatcher) Start() error {
+	return w.runner.Start()
+}
+
+func (w *fileWatcher) Stop() error {
+	return w.runner.Stop()
+}
+
+func (w *fileWatcher) manage(env environment) {
+	w.runner.manage(env)
+}
+
+// Metrics of the file watcher.
+func (w *fileWatcher) Metrics() map[string]float64 {
+	return map[string]float64{
+		"batches": float64(atomic.LoadUint64(&w.batches)),
+		"events":  float64(atomic.LoadUint64(&w.events)),
+	}
+}
+
+// watch scans the watched paths until ctx is canceled or the handler fails.
+func (w *fileWatcher) watch(ctx context.Context) error {
+	var clock = w.runner.opts.Clock
+	var wake = make(chan struct{}, 1)
+	if w.opts.Inotify {
+		notifier, err := notifyChanges(w.paths, wake)
+		if err != nil {
+			w.runner.opts.Dbgf("file watcher falling back to polling; %v", err)
+		} else {
+			defer notifier.Close()
+		}
+	}
+
+	w.files, _ = w.scan()
+	var pending = map[string]FileOp{}
+	var poll = clock.After(w.opts.Interval)
+	var quiet, overdue <-chan time.Time
+	var flush bool
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-poll:
+			poll = clock.After(w.opts.Interval)
+		case <-wake:
+		case <-quiet:
+			flush = true
+		case <-overdue:
+			flush = true
+		}
+		if flush {
+			quiet, overdue, flush = nil, nil, false
+			if err := w.deliver(ctx, pending); err != nil {
+				return err
+			}
+			pending = map[string]FileOp{}
+			continue
+		}
+		var files, events = w.scan()
+		w.files = files
+		if len(events) == 0 {
+			continue
+		}
+		for _, event := range events {
+			mergeFileOp(pending, event)
+		}
+		// the batch is delivered once changes stop for the debounce time, or the max wait after the first change
+		quiet = clock.After(w.opts.Debounce)
+		if overdue == nil {
+			overdue = clock.After(w.opts.MaxWait)
+		}
+	}
+}
+
+// deliver calls the handler with the pending events, sorted by path.
+func (w *fileWatcher) deliver(ctx context.Context, pending map[string]FileOp) error {
+	if len(pending) == 0 {
+		return nil
+	}
+	var events = make([]FileEvent, 0, len(pending))
+	for path, op := range pending {
+		events = append(events, FileEvent{Path: path, Op: op})
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	atomic.AddUint64(&w.batches, 1)
+	atomic.AddUint64(&w.events, uint64(len(events)))
+
+	return safely("file watcher panic", func() error {
+		if err := w.handle(ctx, events); err != nil {
+			return fmt.Errorf("file watcher handler failed; %w", err)
+		}
+		return nil
+	})
+}
+
+// scan returns the current state of the watched files and the events since the previous scan.
+func (w *fileWatcher) scan() (map[string]fileStat, []FileEvent) {
+	var files = map[string]fileStat{}
+	for _, path := range w.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			files[path] = statOf(info)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if info, err := entry.Info(); err == nil {
+				files[filepath.Join(path, entry.Name())] = statOf(info)
+			}
+		}
+	}
+
+	var events []FileEvent
+	for path, stat := range files {
+		previous, ok := w.files[path]
+		switch {
+		case !ok:
+			events = append(events, FileEvent{Path: path, Op: FileCreated})
+		case !previous.modTime.Equal(stat.modTime) || previous.size != stat.size || previous.mode != stat.mode:
+			events = append(events, FileEvent{Path: path, Op: FileModified})
+		}
+	}
+	for path := range w.files {
+		if _, ok := files[path]; !ok {
+			events = append(events, FileEvent{Path: path, Op: FileDeleted})
+		}
+	}
+	return files, events
+}
+
+func statOf(info os.FileInfo) fileStat {
+	return fileStat{modTime: info.ModTime(), size: info.Size(), mode: info.Mode()}
+}
+
+// mergeFileOp adds an event to the pending ones, keeping only the net change to each file since the last batch.
+func mergeFileOp(pending map[string]FileOp, event FileEvent) {
+	previous, ok := pending[event.Path]
+	if !ok {
+		pending[event.Path] = event.Op
+		return
+	}
+	switch {
+	case previous == FileCreated && event.Op == FileDeleted:
+		// the file never existed as far as the handler knows
+		delete(pending, event.Path)
+	case previous == FileCreated:
+		// still a new file, regardless of later modifications
+	case previous == FileDeleted && event.Op == FileCreated:
+		pending[event.Path] = FileModified
+	default:
+		pending[event.Path] = event.Op
+	}
+}
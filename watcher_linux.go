@@ -0,0 +1,55 @@
+//go:build linux
+// +build linux
+
+package procman
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_CLOSE_WRITE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// notifyChanges uses inotify to signal wake whenever something changes on the given paths, or on the directory of the
+// paths which are not directories, until the returned closer is closed. The events themselves are discarded since
+// changes are found by scanning the paths.
+func notifyChanges(paths []string, wake chan<- struct{}) (io.Closer, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize inotify; %w", err)
+	}
+	var watched int
+	for _, path := range paths {
+		var dir = path
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			dir = filepath.Dir(path)
+		}
+		if _, err := syscall.InotifyAddWatch(fd, dir, inotifyMask); err == nil {
+			watched++
+		}
+	}
+	if watched == 0 {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("no path could be watched with inotify")
+	}
+
+	// non blocking file descriptors use the runtime poller, so closing the file stops the pending read
+	var file = os.NewFile(uintptr(fd), "inotify")
+	go func() {
+		var buf = make([]byte, 64*1024)
+		for {
+			if _, err := file.Read(buf); err != nil {
+				return
+			}
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return file, nil
+}
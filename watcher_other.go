@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package procman
+
+import (
+	"fmt"
+	"io"
+)
+
+// notifyChanges fails since inotify is only available on Linux.
+func notifyChanges(paths []string, wake chan<- struct{}) (io.Closer, error) {
+	return nil, fmt.Errorf("inotify is not supported on this platform")
+}
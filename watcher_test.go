@@ -0,0 +1,162 @@
+package procman
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileWatcher(t *testing.T) {
+	// watch starts a watcher and returns the batches it delivers and a function stopping it.
+	var watch = func(t *testing.T, paths []string, opts FileWatcherOptions) (chan []FileEvent, func() error) {
+		var batches = make(chan []FileEvent, 10)
+		var w = NewFileWatcher(paths, func(ctx context.Context, events []FileEvent) error {
+			batches <- events
+			return nil
+		}, opts)
+		var errs = make(chan error, 1)
+		go func() {
+			errs <- w.Start()
+		}()
+		changeGear()
+		return batches, func() error {
+			assert.Nil(t, w.Stop())
+			return <-errs
+		}
+	}
+	var next = func(t *testing.T, batches chan []FileEvent) []FileEvent {
+		select {
+		case events := <-batches:
+			return events
+		case <-time.After(2 * time.Second):
+			t.Fatal("no batch of events delivered")
+			return nil
+		}
+	}
+	var write = func(t *testing.T, path, data string) {
+		assert.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+	}
+	var fast = FileWatcherOptions{Interval: 10 * time.Millisecond, Debounce: 30 * time.Millisecond}
+
+	t.Run("directory", func(t *testing.T) {
+		var dir = t.TempDir()
+		write(t, filepath.Join(dir, "existing"), "a")
+		write(t, filepath.Join(dir, "removed"), "a")
+		batches, stop := watch(t, []string{dir}, fast)
+
+		write(t, filepath.Join(dir, "new"), "a")
+		write(t, filepath.Join(dir, "existing"), "bb")
+		assert.NoError(t, os.Remove(filepath.Join(dir, "removed")))
+		assert.Equal(t, []FileEvent{
+			{Path: filepath.Join(dir, "existing"), Op: FileModified},
+			{Path: filepath.Join(dir, "new"), Op: FileCreated},
+			{Path: filepath.Join(dir, "removed"), Op: FileDeleted},
+		}, next(t, batches))
+		assert.Nil(t, stop())
+	})
+
+	t.Run("file", func(t *testing.T) {
+		var path = filepath.Join(t.TempDir(), "config")
+		batches, stop := watch(t, []string{path}, fast)
+
+		write(t, path, "a")
+		assert.Equal(t, []FileEvent{{Path: path, Op: FileCreated}}, next(t, batches))
+		assert.NoError(t, os.Remove(path))
+		assert.Equal(t, []FileEvent{{Path: path, Op: FileDeleted}}, next(t, batches))
+		assert.Nil(t, stop())
+	})
+
+	t.Run("debounce", func(t *testing.T) {
+		var dir = t.TempDir()
+		batches, stop := watch(t, []string{dir}, FileWatcherOptions{Interval: 10 * time.Millisecond, Debounce: 100 * time.Millisecond})
+
+		for i := 0; i < 5; i++ {
+			write(t, filepath.Join(dir, fmt.Sprintf("file-%d", i)), "a")
+			flapWings()
+		}
+		write(t, filepath.Join(dir, "temp"), "a")
+		flapWings()
+		assert.NoError(t, os.Remove(filepath.Join(dir, "temp")))
+		assert.Len(t, next(t, batches), 5)
+		blink()
+		assert.Len(t, batches, 0)
+		assert.Nil(t, stop())
+	})
+
+	t.Run("max-wait", func(t *testing.T) {
+		var dir = t.TempDir()
+		batches, stop := watch(t, []string{dir}, FileWatcherOptions{Interval: 10 * time.Millisecond, Debounce: 50 * time.Millisecond, MaxWait: 200 * time.Millisecond})
+
+		// changes keep happening more often than the debounce time for longer than the max wait
+		var started = time.Now()
+		var delivered []FileEvent
+		for i := 1; len(delivered) == 0 && time.Since(started) < time.Second; i++ {
+			write(t, filepath.Join(dir, "busy"), strings.Repeat("a", i))
+			select {
+			case delivered = <-batches:
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		assert.Equal(t, []FileEvent{{Path: filepath.Join(dir, "busy"), Op: FileCreated}}, delivered)
+		assert.Less(t, time.Since(started), 500*time.Millisecond)
+		assert.Nil(t, stop())
+	})
+
+	t.Run("inotify", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("inotify is only available on linux")
+		}
+		var dir = t.TempDir()
+		batches, stop := watch(t, []string{dir}, FileWatcherOptions{Interval: time.Hour, Debounce: 10 * time.Millisecond, Inotify: true})
+
+		write(t, filepath.Join(dir, "new"), "a")
+		assert.Equal(t, []FileEvent{{Path: filepath.Join(dir, "new"), Op: FileCreated}}, next(t, batches))
+		assert.Nil(t, stop())
+	})
+
+	t.Run("handler-error", func(t *testing.T) {
+		var dir = t.TempDir()
+		var w = NewFileWatcher([]string{dir}, func(ctx context.Context, events []FileEvent) error {
+			return errDefault
+		}, fast)
+		var errs = make(chan error, 1)
+		go func() {
+			errs <- w.Start()
+		}()
+		changeGear()
+		write(t, filepath.Join(dir, "new"), "a")
+		select {
+		case err := <-errs:
+			assert.ErrorIs(t, err, errDefault)
+		case <-time.After(2 * time.Second):
+			t.Fatal("file watcher did not stop")
+		}
+	})
+}
+
+func TestMergeFileOp(t *testing.T) {
+	var cases = []struct {
+		ops  []FileOp
+		want FileOp
+	}{
+		{ops: []FileOp{FileCreated, FileModified}, want: FileCreated},
+		{ops: []FileOp{FileCreated, FileModified, FileDeleted}},
+		{ops: []FileOp{FileModified, FileDeleted}, want: FileDeleted},
+		{ops: []FileOp{FileDeleted, FileCreated}, want: FileModified},
+		{ops: []FileOp{FileModified, FileModified}, want: FileModified},
+	}
+	for _, c := range cases {
+		var pending = map[string]FileOp{}
+		for _, op := range c.ops {
+			mergeFileOp(pending, FileEvent{Path: "file", Op: op})
+		}
+		assert.Equal(t, c.want, pending["file"], "%v", c.ops)
+	}
+}
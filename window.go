@@ -0,0 +1,147 @@
+package procman
+
+import (
+	"time"
+)
+
+// TimeWindow is a daily period of time in which a job is allowed to run, e.g. from 01:00 to 05:00.
+// A window which ends before it starts spans midnight, e.g. from 22:00 to 02:00.
+type TimeWindow struct {
+	// Start of the window as the time of day, e.g. 3 * time.Hour for 03:00, in the Location's local time.
+	Start time.Duration
+	// End of the window as the time of day, in the Location's local time.
+	End time.Duration
+	// Days of the week on which the window opens. Defaults to every day.
+	Days []time.Weekday
+	// Location the window is defined in. Defaults to time.Local.
+	Location *time.Location
+}
+
+// Blackout is a period of time, from From (inclusive) to To (exclusive), in which a job is not allowed to run.
+type Blackout struct {
+	From time.Time
+	To   time.Time
+}
+
+// timetable answers when a job is allowed to run given its windows and blackouts.
+type timetable struct {
+	windows   []TimeWindow
+	blackouts []Blackout
+}
+
+func (tt timetable) empty() bool {
+	return len(tt.windows) == 0 && len(tt.blackouts) == 0
+}
+
+// allows returns true if the job is allowed to run at t.
+func (tt timetable) allows(t time.Time) bool {
+	var next, ok = tt.next(t)
+	return ok && next.Equal(t)
+}
+
+// next returns the earliest time, at or after t, in which the job is allowed to run, or false if there is none.
+func (tt timetable) next(t time.Time) (time.Time, bool) {
+	// each iteration moves t forward to the next window or past a blackout so a few are enough unless windows and
+	// blackouts keep overlapping, in which case it is as good as never.
+	for i := 0; i < 1000; i++ {
+		var moved bool
+		if len(tt.windows) > 0 {
+			if _, inside := tt.closes(t); !inside {
+				var open, ok = tt.opens(t)
+				if !ok {
+					return time.Time{}, false
+				}
+				t, moved = open, true
+			}
+		}
+		for _, b := range tt.blackouts {
+			if !t.Before(b.From) && t.Before(b.To) {
+				t, moved = b.To, true
+			}
+		}
+		if !moved {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// until returns the time at which the allowance in effect at t ends, or false if it never does.
+func (tt timetable) until(t time.Time) (time.Time, bool) {
+	var end time.Time
+	if len(tt.windows) > 0 {
+		end, _ = tt.closes(t)
+	}
+	for _, b := range tt.blackouts {
+		if b.From.After(t) && (end.IsZero() || b.From.Before(end)) {
+			end = b.From
+		}
+	}
+	return end, !end.IsZero()
+}
+
+// opens returns the time at which the first window opening after t opens.
+func (tt timetable) opens(t time.Time) (time.Time, bool) {
+	var first time.Time
+	for _, w := range tt.windows {
+		w.each(t, func(open, _ time.Time) {
+			if open.After(t) && (first.IsZero() || open.Before(first)) {
+				first = open
+			}
+		})
+	}
+	return first, !first.IsZero()
+}
+
+// closes returns the time at which the latest closing window open at t closes, and false if no window is open at t.
+func (tt timetable) closes(t time.Time) (time.Time, bool) {
+	var last time.Time
+	for _, w := range tt.windows {
+		w.each(t, func(open, close time.Time) {
+			if !t.Before(open) && t.Before(close) && close.After(last) {
+				last = close
+			}
+		})
+	}
+	return last, !last.IsZero()
+}
+
+// each calls fn with the open and close times of each occurrence of the window from the day before t up to a week after t.
+func (w TimeWindow) each(t time.Time, fn func(open, close time.Time)) {
+	var loc = w.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	// a window ending before it starts closes on the next day
+	var overnight = 0
+	if w.End <= w.Start {
+		overnight = 1
+	}
+	t = t.In(loc)
+	for d := -1; d <= 7; d++ {
+		var day = time.Date(t.Year(), t.Month(), t.Day()+d, 0, 0, 0, 0, loc)
+		if !w.opensOn(day.Weekday()) {
+			continue
+		}
+		fn(wallClock(day, 0, w.Start), wallClock(day, overnight, w.End))
+	}
+}
+
+// wallClock returns the time of day given as an offset from midnight, days after the given day, as shown by clocks in
+// its location, so windows keep their hours on days when clocks change.
+func wallClock(day time.Time, days int, offset time.Duration) time.Time {
+	var h, m, s, ns = offset / time.Hour, offset % time.Hour / time.Minute, offset % time.Minute / time.Second, offset % time.Second
+	return time.Date(day.Year(), day.Month(), day.Day()+days, int(h), int(m), int(s), int(ns), day.Location())
+}
+
+func (w TimeWindow) opensOn(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
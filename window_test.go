@@ -0,0 +1,81 @@
+package procman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimetable(t *testing.T) {
+	var at = func(day, hour, min int) time.Time {
+		// 2024-01-01 is a monday
+		return time.Date(2024, time.January, day, hour, min, 0, 0, time.UTC)
+	}
+	var next = func(tt timetable, from time.Time) time.Time {
+		var next, ok = tt.next(from)
+		assert.True(t, ok)
+		return next
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		var tt = timetable{}
+		assert.True(t, tt.empty())
+		assert.True(t, tt.allows(at(1, 12, 0)))
+		var _, ok = tt.until(at(1, 12, 0))
+		assert.False(t, ok)
+	})
+	t.Run("daily", func(t *testing.T) {
+		var tt = timetable{windows: []TimeWindow{{Start: time.Hour, End: 5 * time.Hour, Location: time.UTC}}}
+		assert.Equal(t, at(1, 1, 0), next(tt, at(1, 0, 30)))
+		assert.Equal(t, at(1, 2, 0), next(tt, at(1, 2, 0)))
+		assert.Equal(t, at(2, 1, 0), next(tt, at(1, 5, 0)))
+		var end, ok = tt.until(at(1, 2, 0))
+		assert.True(t, ok)
+		assert.Equal(t, at(1, 5, 0), end)
+	})
+	t.Run("over-midnight", func(t *testing.T) {
+		var tt = timetable{windows: []TimeWindow{{Start: 22 * time.Hour, End: 2 * time.Hour, Location: time.UTC}}}
+		assert.True(t, tt.allows(at(1, 23, 0)))
+		assert.True(t, tt.allows(at(2, 1, 0)))
+		assert.False(t, tt.allows(at(2, 3, 0)))
+		var end, _ = tt.until(at(1, 23, 0))
+		assert.Equal(t, at(2, 2, 0), end)
+	})
+	t.Run("weekdays", func(t *testing.T) {
+		var tt = timetable{windows: []TimeWindow{{Start: time.Hour, End: 2 * time.Hour, Days: []time.Weekday{time.Saturday}, Location: time.UTC}}}
+		assert.Equal(t, at(6, 1, 0), next(tt, at(1, 12, 0)))
+	})
+	t.Run("time-zone", func(t *testing.T) {
+		var tt = timetable{windows: []TimeWindow{{Start: time.Hour, End: 2 * time.Hour, Location: time.FixedZone("UTC+3", 3*3600)}}}
+		assert.True(t, at(1, 22, 0).Equal(next(tt, at(1, 12, 0))))
+	})
+	t.Run("daylight-saving", func(t *testing.T) {
+		lisbon, err := time.LoadLocation("Europe/Lisbon")
+		if err != nil {
+			t.Skip("time zone database not available")
+		}
+		var tt = timetable{windows: []TimeWindow{{Start: 3 * time.Hour, End: 5 * time.Hour, Location: lisbon}}}
+		// clocks go forward from 01:00 to 02:00 on 2026-03-29 and back from 02:00 to 01:00 on 2026-10-25
+		for _, from := range []time.Time{
+			time.Date(2026, time.March, 29, 0, 30, 0, 0, lisbon),
+			time.Date(2026, time.October, 25, 0, 30, 0, 0, lisbon),
+		} {
+			var open = next(tt, from)
+			assert.Equal(t, from.Day(), open.In(lisbon).Day())
+			assert.Equal(t, "03:00", open.In(lisbon).Format("15:04"))
+			var end, _ = tt.until(open)
+			assert.Equal(t, "05:00", end.In(lisbon).Format("15:04"))
+		}
+	})
+	t.Run("blackouts", func(t *testing.T) {
+		var tt = timetable{
+			windows:   []TimeWindow{{Start: 0, End: 6 * time.Hour, Location: time.UTC}},
+			blackouts: []Blackout{{From: at(1, 1, 0), To: at(1, 2, 0)}, {From: at(2, 0, 0), To: at(3, 0, 0)}},
+		}
+		assert.Equal(t, at(1, 2, 0), next(tt, at(1, 1, 30)))
+		assert.Equal(t, at(3, 0, 0), next(tt, at(1, 7, 0)))
+		var end, _ = tt.until(at(1, 0, 30))
+		assert.Equal(t, at(1, 1, 0), end)
+	})
+}
@@ -9,6 +9,8 @@ import (
 type WorkerOptions struct {
 	// ShutdownTimeout sets the timeout to wait for Start() to finish after Stop() is called.
 	ShutdownTimeout time.Duration
+	// Clock used for the shutdown timeout. Defaults to the manager's clock or the SystemClock.
+	Clock Clock
 }
 
 // NewWorker creates a wrapper around a worker function which is expected to return only after ctx.Done() or an error occurs.
@@ -21,6 +23,7 @@ func NewWorker(main func(ctx context.Context) error, opts ...WorkerOptions) Proc
 	for _, opt := range opts {
 		options.merge(PeriodicalOptions{
 			ShutdownTimeout: opt.ShutdownTimeout,
+			Clock:           opt.Clock,
 		})
 	}
 	return NewPeriodicalJob(0, main, options)